@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"clampany/internal/util"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// dashboard はstatus.jsonを読み込んで表示し、キー操作でロールを操作するTUI
+type dashboard struct {
+	ws       workerStatus
+	err      error
+	selected int
+	// 送信メッセージ入力中はinputingがtrue
+	inputing bool
+	input    []rune
+	notice   string
+}
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "ロールの状態・キュー・メッセージの流れを表示し、キー操作でロールを操作する",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDashboard(); err != nil {
+			fmt.Println("dashboardの起動に失敗:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// stty は端末設定を変更・取得する
+func stty(args ...string) (string, error) {
+	c := exec.Command("stty", args...)
+	c.Stdin = os.Stdin
+	out, err := c.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func terminalSize() (rows, cols int) {
+	rows, cols = 40, 120
+	out, err := stty("size")
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 2 {
+		if r, err := strconv.Atoi(fields[0]); err == nil && r > 0 {
+			rows = r
+		}
+		if c, err := strconv.Atoi(fields[1]); err == nil && c > 0 {
+			cols = c
+		}
+	}
+	return
+}
+
+func runDashboard() error {
+	saved, err := stty("-g")
+	if err != nil {
+		return err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return err
+	}
+	// 代替スクリーンに切り替え、カーソルを隠す
+	fmt.Print("\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		stty(saved)
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGHUP)
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	d := &dashboard{}
+	d.refresh()
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		d.render()
+		select {
+		case <-sig:
+			return nil
+		case <-ticker.C:
+			d.refresh()
+		case b, ok := <-keys:
+			if !ok || d.handleKey(b) {
+				return nil
+			}
+		}
+	}
+}
+
+func (d *dashboard) refresh() {
+	ws, err := readWorkerStatus()
+	// 読み込みに失敗しても直前の表示は残す
+	d.err = err
+	if err == nil {
+		d.ws = ws
+	}
+	if d.selected >= len(d.ws.Roles) {
+		d.selected = len(d.ws.Roles) - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+}
+
+func (d *dashboard) selectedRole() (roleStatus, bool) {
+	if d.selected < 0 || d.selected >= len(d.ws.Roles) {
+		return roleStatus{}, false
+	}
+	return d.ws.Roles[d.selected], true
+}
+
+// handleKey はキー入力を処理する。終了する場合はtrueを返す
+func (d *dashboard) handleKey(b []byte) bool {
+	if d.inputing {
+		d.handleInput(b)
+		return false
+	}
+	switch string(b) {
+	case "q", "\x03":
+		return true
+	case "k", "\x1b[A", "\x1bOA":
+		if d.selected > 0 {
+			d.selected--
+		}
+	case "j", "\x1b[B", "\x1bOB":
+		if d.selected < len(d.ws.Roles)-1 {
+			d.selected++
+		}
+	case "f", "\r":
+		d.focus()
+	case "c":
+		d.cancel()
+	case "r":
+		d.requeue()
+	case "s":
+		if _, ok := d.selectedRole(); ok {
+			d.inputing = true
+			d.input = nil
+		}
+	}
+	return false
+}
+
+func (d *dashboard) handleInput(b []byte) {
+	switch string(b) {
+	case "\r":
+		d.inputing = false
+		d.send(strings.TrimSpace(string(d.input)))
+		return
+	case "\x1b", "\x03":
+		d.inputing = false
+		d.notice = "送信を取り消しました"
+		return
+	case "\x7f", "\b":
+		if len(d.input) > 0 {
+			d.input = d.input[:len(d.input)-1]
+		}
+		return
+	}
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if r != utf8.RuneError && !unicode.IsControl(r) {
+			d.input = append(d.input, r)
+		}
+	}
+}
+
+// focus は選択中ロールのペインをアクティブにする
+func (d *dashboard) focus() {
+	rs, ok := d.selectedRole()
+	if !ok {
+		return
+	}
+	if rs.PaneID == "" {
+		d.notice = fmt.Sprintf("%sはペインを持たないロールです", rs.Role)
+		return
+	}
+	if err := exec.Command("tmux", "select-pane", "-t", rs.PaneID).Run(); err != nil {
+		d.notice = fmt.Sprintf("%sのペインに移動できません: %v", rs.Role, err)
+		return
+	}
+	d.notice = fmt.Sprintf("%sのペインに移動しました", rs.Role)
+}
+
+// interrupt は実行中のタスクを中断し、ワーカーにキャンセルを報告する。
+// ペインを持たないshell/humanロールは、報告を受けたワーカーがタスクを止める
+func (d *dashboard) interrupt(rs roleStatus) error {
+	if rs.PaneID != "" {
+		if err := exec.Command("tmux", "send-keys", "-t", rs.PaneID, "Escape").Run(); err != nil {
+			return err
+		}
+	}
+	util.Emit(util.Event{Type: "task.cancelled", Role: rs.Role, MessageID: rs.Task, Data: map[string]interface{}{"reason": "dashboard"}})
+	return writeAgentStatus(agentStatus{
+		Role:      rs.Role,
+		State:     agentIdle,
+		Task:      rs.Task,
+		Source:    "dashboard",
+		Cancelled: true,
+		UpdatedAt: time.Now(),
+	})
+}
+
+func (d *dashboard) cancel() {
+	rs, ok := d.selectedRole()
+	if !ok {
+		return
+	}
+	if rs.Task == "" {
+		d.notice = fmt.Sprintf("%sに実行中のタスクはありません", rs.Role)
+		return
+	}
+	if err := d.interrupt(rs); err != nil {
+		d.notice = fmt.Sprintf("%sのタスク %s をキャンセルできません: %v", rs.Role, rs.Task, err)
+		return
+	}
+	d.notice = fmt.Sprintf("%sのタスク %s をキャンセルしました", rs.Role, rs.Task)
+}
+
+// requeue は実行中のタスクを中断し、同じ内容をキューに戻す
+func (d *dashboard) requeue() {
+	rs, ok := d.selectedRole()
+	if !ok {
+		return
+	}
+	if rs.Task == "" || rs.Command == "" {
+		d.notice = fmt.Sprintf("%sに再キューできるタスクはありません", rs.Role)
+		return
+	}
+	if err := d.interrupt(rs); err != nil {
+		d.notice = fmt.Sprintf("%sのタスク %s を中断できません: %v", rs.Role, rs.Task, err)
+		return
+	}
+	if _, err := enqueueMessage(queueMessage{Parent: rs.Task, From: "dashboard", To: queueOf(rs.Role), Text: rs.Command}); err != nil {
+		d.notice = fmt.Sprintf("再キューに失敗: %v", err)
+		return
+	}
+	d.notice = fmt.Sprintf("%sのタスク %s を%sキューに戻しました", rs.Role, rs.Task, queueOf(rs.Role))
+}
+
+func (d *dashboard) send(text string) {
+	rs, ok := d.selectedRole()
+	if !ok || text == "" {
+		return
+	}
+	if _, err := enqueueMessage(queueMessage{From: "operator", To: queueOf(rs.Role), Text: text}); err != nil {
+		d.notice = fmt.Sprintf("送信に失敗: %v", err)
+		return
+	}
+	d.notice = fmt.Sprintf("%sキューに送信しました", queueOf(rs.Role))
+}
+
+func (d *dashboard) render() {
+	rows, cols := terminalSize()
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, truncateWidth(fmt.Sprintf(format, args...), cols))
+	}
+
+	add("\033[1mClampany dashboard\033[0m  %s", time.Now().Format("15:04:05"))
+	if d.err != nil {
+		add("status.jsonが読み込めません（ワーカーが起動していない可能性があります）: %v", d.err)
+	}
+	add("")
+	add("   %-10s %-8s %6s %5s %4s %6s %-7s %s", "ROLE", "STATE", "TIME", "QUEUE", "DONE", "UTIL5m", "HEALTH", "TASK")
+	for i, rs := range d.ws.Roles {
+		cursor := "  "
+		if i == d.selected {
+			cursor = "\033[7m>\033[0m "
+		}
+		task := ""
+		if rs.Task != "" {
+			task = fmt.Sprintf("[%s] %s", rs.Task, rs.Command)
+		}
+		add(" %s%-10s %-8s %6s %5d %4d %5d%% %-7s %s", cursor, rs.Role, rs.State, formatElapsed(rs.SecondsInState), rs.QueueDepth, rs.Completed, rs.Utilization.Last5m.Rate(), rs.Health, task)
+	}
+
+	add("")
+	var depths []string
+	seen := map[string]bool{}
+	for _, rs := range d.ws.Roles {
+		q := queueOf(rs.Role)
+		if seen[q] {
+			continue
+		}
+		seen[q] = true
+		depths = append(depths, fmt.Sprintf("%s %d", q, len(d.ws.Queues[q])))
+	}
+	add("キュー: %s", strings.Join(depths, " | "))
+
+	add("")
+	backlog := d.ws.Queues["engineer"]
+	add("\033[1m── engineer backlog (%d) ──\033[0m", len(backlog))
+	for i, msg := range backlog {
+		if i >= 5 {
+			add("  ...他%d件", len(backlog)-i)
+			break
+		}
+		add("  %d. [%s] %s", i+1, msg.ID, msg.Text)
+	}
+
+	add("")
+	add("\033[1m── 承認待ち ──\033[0m")
+	for _, rs := range d.ws.Roles {
+		if rs.State != "blocked" {
+			continue
+		}
+		msg := rs.Message
+		if msg == "" {
+			msg = "(詳細なし)"
+		}
+		add("  %s: %s", rs.Role, msg)
+	}
+
+	add("")
+	add("\033[1m── 最近のメッセージ ──\033[0m")
+	for i, m := range d.ws.RecentMessages {
+		if i >= 8 {
+			break
+		}
+		from := m.From
+		if from == "" {
+			from = "?"
+		}
+		add("  %s %s → %s [%s] %s", m.DeliveredAt.Local().Format("15:04:05"), from, m.Role, m.ID, m.Text)
+	}
+
+	// 下部に操作説明と入力欄を固定表示する
+	footer := []string{"", truncateWidth(d.notice, cols)}
+	if d.inputing {
+		rs, _ := d.selectedRole()
+		footer = append(footer, truncateWidth(fmt.Sprintf("%sへ送信> %s_", queueOf(rs.Role), string(d.input)), cols))
+	} else {
+		footer = append(footer, "[↑↓/jk]選択 [f/Enter]ペインへ移動 [c]キャンセル [r]再キュー [s]送信 [q]終了")
+	}
+	if max := rows - len(footer); len(lines) > max && max > 0 {
+		lines = lines[:max]
+	}
+	for len(lines)+len(footer) < rows {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+	fmt.Print("\033[H\033[2J" + strings.Join(lines, "\r\n"))
+}
+
+// truncateWidth は全角文字を幅2として表示幅に収まるよう切り詰める
+func truncateWidth(s string, width int) string {
+	w := 0
+	inEscape := false
+	for i, r := range s {
+		if r == '\033' {
+			inEscape = true
+		}
+		if inEscape {
+			if unicode.IsLetter(r) && r != '[' {
+				inEscape = false
+			}
+			continue
+		}
+		rw := 1
+		if r >= 0x1100 {
+			rw = 2
+		}
+		if w+rw > width {
+			return s[:i] + "\033[0m"
+		}
+		w += rw
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(dashboardCmd)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"clampany/internal"
+	"clampany/internal/loader"
+	"clampany/internal/scheduler"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// graphEdge はタスクグラフの辺。Kindはdepends/clarify/retry
+type graphEdge struct {
+	From, To, Kind, Label string
+}
+
+// taskGraph はgraphコマンドで描くノードと辺
+type taskGraph struct {
+	Tasks []internal.Task
+	Extra []internal.Task // 実行中に確認を求めたときに回答するタスク
+	Edges []graphEdge
+	Roles map[string]internal.RoleType
+}
+
+func buildTaskGraph(tasks []internal.Task, roles []internal.Role, clar internal.ClarificationConfig) taskGraph {
+	g := taskGraph{Tasks: tasks, Roles: map[string]internal.RoleType{}}
+	for _, r := range roles {
+		g.Roles[r.Name] = r.Type
+	}
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			g.Edges = append(g.Edges, graphEdge{From: dep, To: t.Name, Kind: "depends"})
+		}
+		if t.Retries > 0 {
+			g.Edges = append(g.Edges, graphEdge{From: t.Name, To: t.Name, Kind: "retry", Label: fmt.Sprintf("retry ×%d", t.Retries)})
+		}
+		// 確認を求めるのはAIタスクだけ
+		if g.Roles[t.Role] != internal.RoleAI {
+			continue
+		}
+		if target, ok := scheduler.ClarificationTarget(clar, t.Role); ok && clar.MaxRounds > 0 {
+			node := internal.Task{Name: t.Name + "_clarify", Role: target}
+			g.Extra = append(g.Extra, node)
+			g.Edges = append(g.Edges,
+				graphEdge{From: t.Name, To: node.Name, Kind: "clarify", Label: fmt.Sprintf("確認 (最大%d回)", clar.MaxRounds)},
+				graphEdge{From: node.Name, To: t.Name, Kind: "clarify", Label: "回答"},
+			)
+		}
+	}
+	return g
+}
+
+func graphNodeLabel(t internal.Task, roles map[string]internal.RoleType) string {
+	label := t.Name + "\n" + t.Role
+	if typ, ok := roles[t.Role]; ok {
+		label += fmt.Sprintf(" (%s)", typ)
+	}
+	if t.When != "" {
+		label += "\nwhen: " + shorten(t.When, 40)
+	}
+	return label
+}
+
+func writeGraphDot(w io.Writer, g taskGraph) {
+	fmt.Fprintln(w, "digraph tasks {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, t := range g.Tasks {
+		fmt.Fprintf(w, "  %q [label=%q];\n", t.Name, graphNodeLabel(t, g.Roles))
+	}
+	for _, t := range g.Extra {
+		fmt.Fprintf(w, "  %q [label=%q, style=dashed];\n", t.Name, graphNodeLabel(t, g.Roles))
+	}
+	for _, e := range g.Edges {
+		attrs := []string{}
+		if e.Label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%q", e.Label))
+		}
+		if e.Kind != "depends" {
+			attrs = append(attrs, "style=dashed")
+		}
+		suffix := ""
+		if len(attrs) > 0 {
+			suffix = " [" + strings.Join(attrs, ", ") + "]"
+		}
+		fmt.Fprintf(w, "  %q -> %q%s;\n", e.From, e.To, suffix)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func writeGraphMermaid(w io.Writer, g taskGraph) {
+	fmt.Fprintln(w, "graph LR")
+	// タスク名にはMermaidのIDに使えない文字が含まれうるため連番のIDを振る
+	ids := map[string]string{}
+	node := func(t internal.Task, open, close string) {
+		ids[t.Name] = fmt.Sprintf("t%d", len(ids))
+		label := strings.ReplaceAll(graphNodeLabel(t, g.Roles), `"`, "#quot;")
+		fmt.Fprintf(w, "  %s%s\"%s\"%s\n", ids[t.Name], open, strings.ReplaceAll(label, "\n", "<br/>"), close)
+	}
+	for _, t := range g.Tasks {
+		node(t, "[", "]")
+	}
+	for _, t := range g.Extra {
+		node(t, "([", "])")
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind != "depends" {
+			arrow = "-.->"
+		}
+		if e.Label != "" {
+			arrow += "|\"" + e.Label + "\"|"
+		}
+		fmt.Fprintf(w, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+}
+
+var (
+	graphRolesPath string
+	graphFormat    string
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph <tasks.yaml>",
+	Short: "タスクの依存関係グラフをdotまたはmermaidで出力する",
+	Long: `foreach/matrixを展開したタスクの依存関係に加え、AIタスクが確認を求めたときに
+回答するロール(_clampany/config.yamlのclarification)と再実行を破線で出力します。`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// ロール定義はノードの表示と確認タスクの判定にだけ使うため、なくてもよい
+		rolesPath := graphRolesPath
+		if _, err := os.Stat(rolesPath); errors.Is(err, fs.ErrNotExist) {
+			rolesPath = ""
+		}
+		tasks, roles, err := loader.LoadAndValidate(args[0], rolesPath)
+		if err != nil {
+			fmt.Println("タスク・ロール定義にエラーがあります:")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cfg, err := loader.LoadConfig("_clampany/config.yaml")
+		if err != nil {
+			fmt.Println("_clampany/config.yamlの読み込み失敗:", err)
+			os.Exit(1)
+		}
+		tasks, err = scheduler.ExpandTasks(tasks)
+		if err != nil {
+			fmt.Println("タスクの展開に失敗:", err)
+			os.Exit(1)
+		}
+		g := buildTaskGraph(tasks, roles, cfg.Clarification)
+		switch graphFormat {
+		case "dot":
+			writeGraphDot(os.Stdout, g)
+		case "mermaid":
+			writeGraphMermaid(os.Stdout, g)
+		default:
+			fmt.Printf("不明な形式です: %s (dot|mermaid)\n", graphFormat)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+	graphCmd.Flags().StringVar(&graphRolesPath, "roles", "roles.yaml", "ロール定義ファイル")
+	graphCmd.Flags().StringVar(&graphFormat, "format", "dot", "出力形式 (dot|mermaid)")
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const claudeSettingsPath = ".claude/settings.json"
+
+// Claude Codeのフックイベントとclampany hookのイベント名の対応
+var claudeHookEvents = map[string]string{
+	"UserPromptSubmit": "prompt",
+	"Stop":             "stop",
+	"Notification":     "notification",
+}
+
+// claudeHookInput はClaude Codeがフックの標準入力に渡すJSON
+type claudeHookInput struct {
+	SessionID        string `json:"session_id"`
+	TranscriptPath   string `json:"transcript_path"`
+	HookEventName    string `json:"hook_event_name"`
+	Message          string `json:"message"`
+	NotificationType string `json:"notification_type"`
+}
+
+var hookCmd = &cobra.Command{
+	Use:    "hook <prompt|stop|notification>",
+	Short:  "エージェントCLIのフックから呼ばれ、ロールの状態を報告する",
+	Args:   cobra.ExactArgs(1),
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		// clampany外で起動したエージェントからのフックは無視する
+		role := currentRole("")
+		if role == "" {
+			return
+		}
+		var in claudeHookInput
+		json.NewDecoder(os.Stdin).Decode(&in)
+
+		st := agentStatus{
+			Role:      role,
+			Source:    "hook",
+			UpdatedAt: time.Now(),
+		}
+		switch args[0] {
+		case "prompt":
+			st.State = agentBusy
+		case "stop":
+			st.State = agentDone
+			st.Response = lastAssistantMessage(in.TranscriptPath)
+		case "notification":
+			st.Message = in.Message
+			// 入力待ちの通知はidle、それ以外(権限確認など)はblocked
+			if in.NotificationType == "idle_prompt" || strings.Contains(in.Message, "waiting for your input") {
+				st.State = agentIdle
+			} else {
+				st.State = agentBlocked
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "不明なフックイベントです: %s\n", args[0])
+			os.Exit(1)
+		}
+		if err := writeAgentStatus(st); err != nil {
+			fmt.Fprintln(os.Stderr, "ステータス書き込み失敗:", err)
+		}
+	},
+}
+
+// lastAssistantMessage はClaude Codeのトランスクリプト(JSONL)から最後の応答テキストを取り出す
+func lastAssistantMessage(path string) string {
+	if path == "" {
+		return ""
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var last string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		var entry struct {
+			Type    string `json:"type"`
+			Message struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(sc.Bytes(), &entry) != nil || entry.Type != "assistant" {
+			continue
+		}
+		var parts []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(entry.Message.Content, &parts) != nil {
+			continue
+		}
+		var texts []string
+		for _, p := range parts {
+			if p.Type == "text" && strings.TrimSpace(p.Text) != "" {
+				texts = append(texts, p.Text)
+			}
+		}
+		if len(texts) > 0 {
+			last = strings.Join(texts, "\n")
+		}
+	}
+	return last
+}
+
+// installClaudeHooks は.claude/settings.jsonにclampany hookを呼ぶフック設定を追加する。
+// 既存の設定は残し、以前に追加したclampanyのフックだけを置き換える
+func installClaudeHooks() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{}
+	if b, err := os.ReadFile(claudeSettingsPath); err == nil {
+		if err := json.Unmarshal(b, &settings); err != nil {
+			return fmt.Errorf("%sの解析に失敗: %w", claudeSettingsPath, err)
+		}
+	}
+	hooks, _ := settings["hooks"].(map[string]interface{})
+	if hooks == nil {
+		hooks = map[string]interface{}{}
+	}
+	for event, name := range claudeHookEvents {
+		command := fmt.Sprintf("%q hook %s", exe, name)
+		var kept []interface{}
+		existing, _ := hooks[event].([]interface{})
+		for _, entry := range existing {
+			if !isClampanyHookEntry(entry, name) {
+				kept = append(kept, entry)
+			}
+		}
+		kept = append(kept, map[string]interface{}{
+			"hooks": []interface{}{
+				map[string]interface{}{"type": "command", "command": command},
+			},
+		})
+		hooks[event] = kept
+	}
+	settings["hooks"] = hooks
+
+	if err := os.MkdirAll(filepath.Dir(claudeSettingsPath), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(claudeSettingsPath, append(b, '\n'), 0644)
+}
+
+func isClampanyHookEntry(entry interface{}, name string) bool {
+	m, _ := entry.(map[string]interface{})
+	list, _ := m["hooks"].([]interface{})
+	for _, h := range list {
+		hm, _ := h.(map[string]interface{})
+		if command, _ := hm["command"].(string); strings.HasSuffix(command, " hook "+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// claudeHooksInstalled は.claude/settings.jsonにclampanyのStopフックがあるかを返す
+func claudeHooksInstalled() bool {
+	b, err := os.ReadFile(claudeSettingsPath)
+	if err != nil {
+		return false
+	}
+	var settings struct {
+		Hooks map[string][]interface{} `json:"hooks"`
+	}
+	if json.Unmarshal(b, &settings) != nil {
+		return false
+	}
+	for _, entry := range settings.Hooks["Stop"] {
+		if isClampanyHookEntry(entry, "stop") {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(hookCmd)
+}
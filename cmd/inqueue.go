@@ -1,19 +1,23 @@
 package cmd
 
 import (
-	"crypto/sha256"
+	"clampany/internal/loader"
+	"clampany/internal/util"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var inqueueMutex sync.Mutex
 var inqueueCounter = map[string]int{}
+var inqueueTimeout time.Duration
+var inqueueParent string
 
 var inqueueCmd = &cobra.Command{
 	Use:   "inqueue <role> <message>",
@@ -44,6 +48,11 @@ var inqueueCmd = &cobra.Command{
 				fromRole = strings.Fields(parts[1])[0]
 			}
 		}
+		// ペインから実行された場合はCLAMPANY_ROLEが送り元（記録用）
+		sender := currentRole("")
+		if sender == "" {
+			sender = fromRole
+		}
 		// fromRoleがなければ許可（従来通り）
 		if fromRole != "" {
 			ok := false
@@ -54,6 +63,7 @@ var inqueueCmd = &cobra.Command{
 				ok = true // ボトムアップ
 			}
 			if !ok {
+				util.Emit(util.Event{Type: "message.rejected", Data: map[string]interface{}{"from": fromRole, "to": role, "text": message}})
 				// ペインに警告送信
 				// run/latest/panes.jsonからペインID取得
 				f, err := os.Open("run/latest/panes.json")
@@ -105,6 +115,14 @@ var inqueueCmd = &cobra.Command{
 				}
 			}
 		}
+		// config.yamlのshell/humanロールからも
+		if cfg, err := loader.LoadConfig("_clampany/config.yaml"); err == nil {
+			for _, r := range cfg.Roles {
+				if strings.HasPrefix(r.Name, role) {
+					candidates = append(candidates, r.Name)
+				}
+			}
+		}
 		if len(candidates) == 0 {
 			fmt.Printf("ロール %s が見つかりません\n", role)
 			os.Exit(1)
@@ -115,12 +133,17 @@ var inqueueCmd = &cobra.Command{
 		inqueueCounter[role]++
 		inqueueMutex.Unlock()
 		assigned := candidates[idx]
-		queueFile := fmt.Sprintf("_clampany/queue/%s_queue_%s.md", role, fmt.Sprintf("%x", sha256.Sum256([]byte(message)))[:8])
-		// 改行をスペースに置換して1行にまとめる
-		message = strings.ReplaceAll(message, "\n", " ")
-		message = strings.ReplaceAll(message, "\r", " ")
-		section := message + "\n"
-		if err := os.WriteFile(queueFile, []byte(section), 0644); err != nil {
+		// 送り元が処理中のメッセージを親として記録する
+		parent := inqueueParent
+		if parent == "" && sender != "" {
+			parent = currentTaskOf(sender)
+		}
+		msg := queueMessage{From: sender, To: role, Text: message, Parent: parent}
+		if inqueueTimeout > 0 {
+			msg.Timeout = inqueueTimeout.String()
+		}
+		queueFile, err := enqueueMessage(msg)
+		if err != nil {
 			fmt.Println(queueFile+"書き込み失敗:", err)
 			os.Exit(1)
 		}
@@ -130,4 +153,6 @@ var inqueueCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(inqueueCmd)
+	inqueueCmd.Flags().StringVar(&inqueueParent, "parent", "", "親メッセージのID (省略時は送り元ロールが処理中のタスク)")
+	inqueueCmd.Flags().DurationVar(&inqueueTimeout, "timeout", 0, "このタスクの停止判定時間 (例: --timeout 30m)")
 }
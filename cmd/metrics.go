@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bufio"
+	"clampany/internal/util"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// タスク所要時間のヒストグラムの境界(秒)
+var taskDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// histogram はPrometheusの累積ヒストグラム
+type histogram struct {
+	counts []uint64 // taskDurationBucketsの各境界以下の件数(累積ではない)
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(taskDurationBuckets))
+	}
+	for i, b := range taskDurationBuckets {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ワーカーが集計するメトリクス。muで保護する
+var (
+	messagesEnqueued  = map[string]int{}        // キューごとの受信メッセージ数
+	messagesDelivered = map[string]int{}        // ロールごとの配信数
+	taskDurations     = map[string]*histogram{} // ロールごとのタスク所要時間
+)
+
+// observeTaskDuration は完了したタスクの所要時間を記録する。呼び出し側でmuを保持していること
+func observeTaskDuration(role string, d time.Duration) {
+	h := taskDurations[role]
+	if h == nil {
+		h = &histogram{}
+		taskDurations[role] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// inqueueの拒否はevents.jsonlのmessage.rejectedから数える。
+// 読み込み済みの位置を覚えておき、追記分だけを読む。
+// ファイルの読み込み中にワーカーを止めないよう、muではなくrejectionMuで保護する
+var (
+	rejectionMu     sync.Mutex
+	rejectionOffset int64
+	rejectionCounts = map[[2]string]int{}
+)
+
+func countRejections() map[[2]string]int {
+	rejectionMu.Lock()
+	defer rejectionMu.Unlock()
+	if f, err := os.Open(eventsPath); err == nil {
+		f.Seek(rejectionOffset, io.SeekStart)
+		br := bufio.NewReader(f)
+		for {
+			line, err := br.ReadBytes('\n')
+			if err != nil {
+				// 書き込み途中の行は次回読み直す
+				break
+			}
+			rejectionOffset += int64(len(line))
+			var ev util.Event
+			if json.Unmarshal(line, &ev) != nil || ev.Type != "message.rejected" {
+				continue
+			}
+			from, _ := ev.Data["from"].(string)
+			to, _ := ev.Data["to"].(string)
+			rejectionCounts[[2]string{from, to}]++
+		}
+		f.Close()
+	}
+	counts := make(map[[2]string]int, len(rejectionCounts))
+	for k, v := range rejectionCounts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// metricsWriter はPrometheusテキスト形式とOpenMetrics形式の差を吸収する
+type metricsWriter struct {
+	w           io.Writer
+	openMetrics bool
+}
+
+func (m metricsWriter) family(name, typ, help string) {
+	// OpenMetricsではcounterのファミリー名に_totalを付けない
+	if m.openMetrics && typ == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (m metricsWriter) sample(name string, labels map[string]string, v float64) {
+	var pairs []string
+	for k, val := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, escapeLabel(val)))
+	}
+	sort.Strings(pairs)
+	lbl := ""
+	if len(pairs) > 0 {
+		lbl = "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(m.w, "%s%s %g\n", name, lbl, v)
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+var roleStates = []string{"init", "waiting", "running", "blocked"}
+
+func writeMetrics(m metricsWriter) {
+	mu.Lock()
+	queueDepth := map[string]int{}
+	for q, msgs := range pendingMessages {
+		queueDepth[q] = len(msgs)
+	}
+	enqueued := copyCounts(messagesEnqueued)
+	delivered := copyCounts(messagesDelivered)
+	restarts := copyCounts(restartCount)
+	states := map[string]string{}
+	for _, role := range workerRoles() {
+		states[role] = paneStatus[role]
+	}
+	durations := map[string]histogram{}
+	for role, h := range taskDurations {
+		durations[role] = histogram{counts: append([]uint64(nil), h.counts...), sum: h.sum, count: h.count}
+	}
+	roles := workerRoles()
+	mu.Unlock()
+
+	m.family("clampany_queue_depth", "gauge", "Number of messages waiting in each queue.")
+	for _, q := range sortedKeys(queueDepth) {
+		m.sample("clampany_queue_depth", map[string]string{"queue": q}, float64(queueDepth[q]))
+	}
+
+	m.family("clampany_messages_enqueued_total", "counter", "Messages read from each queue.")
+	for _, q := range sortedKeys(enqueued) {
+		m.sample("clampany_messages_enqueued_total", map[string]string{"queue": q}, float64(enqueued[q]))
+	}
+
+	m.family("clampany_messages_delivered_total", "counter", "Messages delivered to each role.")
+	for _, role := range roles {
+		m.sample("clampany_messages_delivered_total", map[string]string{"role": role}, float64(delivered[role]))
+	}
+
+	m.family("clampany_role_state", "gauge", "Current state of each role (1 for the active state).")
+	for _, role := range roles {
+		for _, st := range roleStates {
+			v := 0.0
+			if states[role] == st {
+				v = 1
+			}
+			m.sample("clampany_role_state", map[string]string{"role": role, "state": st}, v)
+		}
+	}
+
+	m.family("clampany_agent_restarts_total", "counter", "Agent restarts triggered by stall handling.")
+	for _, role := range roles {
+		m.sample("clampany_agent_restarts_total", map[string]string{"role": role}, float64(restarts[role]))
+	}
+
+	m.family("clampany_task_duration_seconds", "histogram", "Time from delivering a task to the role becoming idle.")
+	for _, role := range sortedKeys(durations) {
+		h := durations[role]
+		var cum uint64
+		for i, b := range taskDurationBuckets {
+			if h.counts != nil {
+				cum += h.counts[i]
+			}
+			m.sample("clampany_task_duration_seconds_bucket", map[string]string{"role": role, "le": fmt.Sprintf("%g", b)}, float64(cum))
+		}
+		m.sample("clampany_task_duration_seconds_bucket", map[string]string{"role": role, "le": "+Inf"}, float64(h.count))
+		m.sample("clampany_task_duration_seconds_sum", map[string]string{"role": role}, h.sum)
+		m.sample("clampany_task_duration_seconds_count", map[string]string{"role": role}, float64(h.count))
+	}
+
+	m.family("clampany_routing_rejections_total", "counter", "Messages rejected by the inqueue role hierarchy check.")
+	rejections := countRejections()
+	var keys [][2]string
+	for k := range rejections {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1]
+	})
+	for _, k := range keys {
+		m.sample("clampany_routing_rejections_total", map[string]string{"from": k[0], "to": k[1]}, float64(rejections[k]))
+	}
+
+	if m.openMetrics {
+		fmt.Fprintln(m.w, "# EOF")
+	}
+}
+
+func copyCounts(src map[string]int) map[string]int {
+	dst := make(map[string]int, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsListenAddr はメトリクスの待ち受けアドレスを検査する。ホストを省略したら127.0.0.1とし、
+// ループバック以外に解決されるホスト(0.0.0.0やLANのアドレスなど)は受け付けない
+func metricsListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("アドレスが不正です: %s: %w", addr, err)
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", fmt.Errorf("ホストを解決できません: %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() {
+			continue
+		}
+		if ip.String() == host {
+			return "", fmt.Errorf("メトリクスはループバックのアドレスでのみ公開できます: %s", host)
+		}
+		return "", fmt.Errorf("メトリクスはループバックのアドレスでのみ公開できます: %s は %s に解決されます", host, ip)
+	}
+	return addr, nil
+}
+
+// startMetricsServer は/metricsでPrometheus/OpenMetrics形式のメトリクスを公開する。
+// ホストを省略した場合は127.0.0.1で待ち受ける
+func startMetricsServer(addr string) error {
+	addr, err := metricsListenAddr(addr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		om := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if om {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		writeMetrics(metricsWriter{w: w, openMetrics: om})
+	})
+	fmt.Printf("[Clampany] メトリクス: http://%s/metrics\n", ln.Addr())
+	go http.Serve(ln, mux)
+	return nil
+}
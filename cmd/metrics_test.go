@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsListenAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr string
+	}{
+		{addr: ":9464", want: "127.0.0.1:9464"},
+		{addr: "127.0.0.1:9464", want: "127.0.0.1:9464"},
+		{addr: "[::1]:9464", want: "[::1]:9464"},
+		{addr: "0.0.0.0:9464", wantErr: "ループバックのアドレスでのみ"},
+		{addr: "[::]:9464", wantErr: "ループバックのアドレスでのみ"},
+		{addr: "192.168.1.10:9464", wantErr: "ループバックのアドレスでのみ"},
+		{addr: "9464", wantErr: "アドレスが不正です"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := metricsListenAddr(tt.addr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, 期待は %q を含むエラー", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("metricsListenAddr = %q, %v, 期待は %q", got, err, tt.want)
+			}
+		})
+	}
+}
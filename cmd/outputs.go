@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// taskOutputMeta はrun/<session>/outputs/<task-id>.mdの先頭に付けるメタデータ
+type taskOutputMeta struct {
+	Task            string    `yaml:"task"`
+	Role            string    `yaml:"role"`
+	From            string    `yaml:"from,omitempty"`
+	Prompt          string    `yaml:"prompt"`
+	StartedAt       time.Time `yaml:"started_at"`
+	CompletedAt     time.Time `yaml:"completed_at"`
+	DurationSeconds float64   `yaml:"duration_seconds"`
+}
+
+// transcriptSize はロールのトランスクリプトの現在のサイズを返す
+func transcriptSize(role string) int64 {
+	fi, err := os.Stat(transcriptPath(sessionDir, role))
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// readTranscriptRange はロールのトランスクリプトの[offset, end)を返す。
+// 完了後すぐに次のタスクが配信されるため、完了時点の位置までで切る
+func readTranscriptRange(role string, offset, end int64) []byte {
+	if end <= offset {
+		return nil
+	}
+	f, err := os.Open(transcriptPath(sessionDir, role))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	b, _ := io.ReadAll(io.NewSectionReader(f, offset, end-offset))
+	return b
+}
+
+// saveTaskOutput はプロンプト配信からidleに戻るまで([offset, end))のトランスクリプトを切り出し、
+// run/<session>/outputs/<task-id>.mdに保存する
+func saveTaskOutput(meta taskOutputMeta, offset, end int64, response string) error {
+	excerpt := readTranscriptRange(meta.Role, offset, end)
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	if err := yaml.NewEncoder(&buf).Encode(meta); err != nil {
+		return err
+	}
+	buf.WriteString("---\n\n")
+	if response != "" {
+		buf.WriteString("## 最終応答\n\n")
+		buf.WriteString(response)
+		buf.WriteString("\n\n")
+	}
+	buf.WriteString("## トランスクリプト\n\n```\n")
+	buf.Write(excerpt)
+	buf.WriteString("```\n")
+
+	dir := filepath.Join(sessionDir, "outputs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.md", meta.Task)), buf.Bytes(), 0644)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"clampany/internal"
+	"clampany/internal/executor"
+	"clampany/internal/util"
+	"context"
+	_ "embed"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// dagPersona はDAGのAIロールのエージェントに起動時に渡す指示。
+// ワーカーモードの指示(ロール間の依頼やキューの規則)は含めず、ステータスプロトコルだけを伝える
+//
+//go:embed personas/dag.md
+var dagPersona []byte
+
+// dagAgentCommand はDAGのAIロールのエージェントをpersonaPathの指示で起動するコマンドを返す
+func dagAgentCommand(role, personaPath string) string {
+	return fmt.Sprintf(`CLAMPANY_ROLE=%s claude --dangerously-skip-permissions "$(cat %q)"`, role, personaPath)
+}
+
+// paneTaskExecutor はスケジューラのAIタスクを永続ペインのエージェントに送り、
+// ステータスプロトコルで完了が報告されるまで待つ
+type paneTaskExecutor struct {
+	Role   string
+	PaneID string
+}
+
+// completesTask は報告がタスクの完了を表すかを返す。マーカーとCLIの報告はタスクIDが一致するものだけを受け付ける。
+// フックの報告はタスクIDを持たないため、送信後に届いたもの(呼び出し側で確認する)に限りこのタスクの完了とみなす。
+// [READY]はタスクIDを持たず起動時にも出力されるため、完了とはみなさない
+func completesTask(st agentStatus, task string) bool {
+	if st.State != agentIdle && st.State != agentDone {
+		return false
+	}
+	return st.Task == task || (st.Task == "" && st.Source == "hook")
+}
+
+func (e *paneTaskExecutor) Execute(ctx context.Context, req internal.ExecRequest) (internal.ExecResult, error) {
+	offset := transcriptSize(e.Role)
+	ai := &executor.AIExecutor{PaneID: e.PaneID, Wait: func(ctx context.Context, t internal.Task, sent time.Time) (string, error) {
+		util.Emit(util.Event{Type: "task.started", Role: e.Role, MessageID: t.Name})
+		st, err := e.wait(ctx, t.Name, offset, sent)
+		if err != nil {
+			if ctx.Err() != nil {
+				util.Emit(util.Event{Type: "task.cancelled", Role: e.Role, MessageID: t.Name})
+			}
+			return "", err
+		}
+		if st.Cancelled {
+			util.Emit(util.Event{Type: "task.cancelled", Role: e.Role, MessageID: t.Name})
+			return "", fmt.Errorf("タスクがキャンセルされました")
+		}
+		util.Emit(util.Event{Type: "task.completed", Role: e.Role, MessageID: t.Name})
+		if st.Response != "" {
+			return st.Response, nil
+		}
+		// フックがなければ配信から完了までのトランスクリプトを出力とする
+		return transcriptExcerpt(e.Role, offset, transcriptSize(e.Role)), nil
+	}}
+	return ai.Execute(ctx, req)
+}
+
+// wait はタスクに対するidle/doneの報告を待つ。マーカーはトランスクリプトのoffset(送信前の位置)以降から読む。
+// blockedの報告は一度だけ表示する。ctxが終了したらエージェントの作業をEscapeで止めて戻る
+func (e *paneTaskExecutor) wait(ctx context.Context, task string, offset int64, since time.Time) (agentStatus, error) {
+	var lastBlocked time.Time
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			exec.Command("tmux", "send-keys", "-t", e.PaneID, "Escape").Run()
+			return agentStatus{}, ctx.Err()
+		case <-ticker.C:
+		}
+		if paneHealth(e.PaneID) != "ok" {
+			return agentStatus{}, fmt.Errorf("%sのペインが終了しました", e.Role)
+		}
+		if st, err := readAgentStatus(e.Role); err == nil && st.UpdatedAt.After(since) {
+			if completesTask(st, task) {
+				return st, nil
+			}
+			if st.State == agentBlocked && st.UpdatedAt.After(lastBlocked) {
+				lastBlocked = st.UpdatedAt
+				util.Info("[BLOCKED] %s (%s): %s", task, e.Role, st.Message)
+			}
+		}
+		var markers []agentStatus
+		markers, offset = transcriptMarkers(e.Role, offset)
+		for _, st := range markers {
+			if completesTask(st, task) {
+				return st, nil
+			}
+		}
+	}
+}
+
+// transcriptExcerpt はトランスクリプトの[offset, end)をタイムスタンプを除いて返す
+func transcriptExcerpt(role string, offset, end int64) string {
+	lines := strings.Split(string(readTranscriptRange(role, offset, end)), "\n")
+	for i, line := range lines {
+		lines[i] = stripTranscriptTime(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
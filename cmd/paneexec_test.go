@@ -0,0 +1,28 @@
+package cmd
+
+import "testing"
+
+func TestCompletesTask(t *testing.T) {
+	tests := []struct {
+		name string
+		st   agentStatus
+		want bool
+	}{
+		{name: "タスクが一致するマーカー", st: agentStatus{State: agentDone, Task: "build", Source: "marker"}, want: true},
+		{name: "タスクが一致するCLIのidle", st: agentStatus{State: agentIdle, Task: "build", Source: "cli"}, want: true},
+		{name: "別のタスクのマーカー", st: agentStatus{State: agentDone, Task: "test", Source: "marker"}, want: false},
+		{name: "[READY]", st: agentStatus{State: agentIdle, Source: "ready"}, want: false},
+		{name: "タスクなしのマーカー", st: agentStatus{State: agentDone, Source: "marker"}, want: false},
+		{name: "タスクなしのCLI", st: agentStatus{State: agentDone, Source: "cli"}, want: false},
+		{name: "タスクなしのフック", st: agentStatus{State: agentDone, Source: "hook"}, want: true},
+		{name: "busy", st: agentStatus{State: agentBusy, Task: "build", Source: "cli"}, want: false},
+		{name: "blocked", st: agentStatus{State: agentBlocked, Task: "build", Source: "hook"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := completesTask(tt.st, "build"); got != tt.want {
+				t.Errorf("completesTask = %v, 期待は %v", got, tt.want)
+			}
+		})
+	}
+}
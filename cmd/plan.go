@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"clampany/internal/loader"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const plansDir = "_clampany/plans"
+
+var (
+	planOut       string
+	planRolesPath string
+	planForce     bool
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "PMが_clampany/plans/に書いた計画を扱う",
+}
+
+var planImportCmd = &cobra.Command{
+	Use:   "import <plan>",
+	Short: "計画ファイルをtasks.yamlに変換する",
+	Long: `PMが_clampany/plans/に書いた計画(id・担当ロール・依存関係・完了条件を持つタスクの一覧)を
+runで実行できるtasks.yamlに変換します。<plan>にはファイルのパス、または_clampany/plans/内の名前を指定します。
+roles.yamlがあれば、変換したタスクを実行前と同じ方法で検査します。`,
+	Example: `  ./clampany plan import todo-app -o tasks.yaml
+  ./clampany run tasks.yaml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := resolvePlanPath(args[0])
+		plan, err := loader.LoadPlan(path)
+		if err != nil {
+			fmt.Println("計画にエラーがあります:")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(planOut); err == nil && !planForce {
+			fmt.Printf("%s は既にあります。上書きする場合は--forceを指定してください\n", planOut)
+			os.Exit(1)
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "# %s から clampany plan import で生成\n", path)
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(loader.TasksFile{Tasks: loader.PlanTasks(plan)}); err != nil {
+			fmt.Println("tasks.yamlの作成失敗:", err)
+			os.Exit(1)
+		}
+		enc.Close()
+
+		// 検査してから書き込み、誤りのあるtasks.yamlを残さない
+		tmp := planOut + ".tmp"
+		if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+			fmt.Println("tasks.yamlの書き込み失敗:", err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(planRolesPath); err == nil {
+			if _, _, err := loader.LoadAndValidate(tmp, planRolesPath); err != nil {
+				os.Remove(tmp)
+				fmt.Printf("変換したタスクを%sで検査したところエラーがあります (ownerには%sのロール名を書いてください):\n", planRolesPath, planRolesPath)
+				fmt.Println(strings.ReplaceAll(err.Error(), tmp, planOut))
+				os.Exit(1)
+			}
+		}
+		if err := os.Rename(tmp, planOut); err != nil {
+			fmt.Println("tasks.yamlの書き込み失敗:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d件のタスクを%sに書き込みました\n", len(plan.Tasks), planOut)
+	},
+}
+
+// resolvePlanPath はファイルがなければ_clampany/plans/内の名前として探す
+func resolvePlanPath(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	for _, candidate := range []string{
+		filepath.Join(plansDir, name),
+		filepath.Join(plansDir, name+".yaml"),
+		filepath.Join(plansDir, name+".yml"),
+	} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return name
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.AddCommand(planImportCmd)
+	planImportCmd.Flags().StringVarP(&planOut, "out", "o", "tasks.yaml", "書き込むtasks.yaml")
+	planImportCmd.Flags().StringVar(&planRolesPath, "roles", "roles.yaml", "ownerの検査に使うロール定義ファイル")
+	planImportCmd.Flags().BoolVar(&planForce, "force", false, "既存のファイルを上書きする")
+}
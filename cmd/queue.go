@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"clampany/internal/util"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const queueDir = "_clampany/queue"
+
+// queueMessage はキューファイルの1行に書かれるロール間メッセージ。
+// 旧形式のプレーンテキスト行も読み込み時にIDを振って扱う
+type queueMessage struct {
+	ID        string    `json:"id"`
+	Parent    string    `json:"parent,omitempty"` // 送信時に送り元が処理していたメッセージのID
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Text      string    `json:"text"`
+	Timeout   string    `json:"timeout,omitempty"` // タスクごとの停止判定時間(例: 30m)
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newMessageID() string {
+	return util.NewUUID()[:8]
+}
+
+// parseQueueLine はキューファイルの1行をメッセージに変換する
+func parseQueueLine(line, to string) queueMessage {
+	var msg queueMessage
+	if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &msg) == nil && msg.Text != "" {
+		if msg.ID == "" {
+			msg.ID = newMessageID()
+		}
+		if msg.To == "" {
+			msg.To = to
+		}
+		return msg
+	}
+	// 手書きの行はワーカーが読み込んだ時点でキューに入ったとみなす
+	msg = queueMessage{ID: newMessageID(), To: to, Text: line, CreatedAt: time.Now()}
+	util.Emit(util.Event{Type: "message.enqueued", MessageID: msg.ID, Data: map[string]interface{}{"to": msg.To, "text": msg.Text}})
+	return msg
+}
+
+// currentTaskOf はワーカーのstatus.jsonからロールが処理中のメッセージIDを返す
+func currentTaskOf(role string) string {
+	ws, err := readWorkerStatus()
+	if err != nil {
+		return ""
+	}
+	for _, rs := range ws.Roles {
+		if rs.Role == role {
+			return rs.Task
+		}
+	}
+	return ""
+}
+
+// enqueueMessage はメッセージを_clampany/queue/<to>_queue_<id>.mdに書き込み、ファイル名を返す
+func enqueueMessage(msg queueMessage) (string, error) {
+	if msg.ID == "" {
+		msg.ID = newMessageID()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	// 改行をスペースに置換して1行にまとめる
+	msg.Text = strings.ReplaceAll(msg.Text, "\n", " ")
+	msg.Text = strings.ReplaceAll(msg.Text, "\r", " ")
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(queueDir, 0755); err != nil {
+		return "", err
+	}
+	queueFile := fmt.Sprintf("%s/%s_queue_%s.md", queueDir, msg.To, msg.ID)
+	// 書き込み途中のファイルをワーカーが読まないようにrenameで置き換える
+	tmp := queueFile + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, queueFile); err != nil {
+		return queueFile, err
+	}
+	util.Emit(util.Event{Type: "message.enqueued", MessageID: msg.ID, Data: map[string]interface{}{"from": msg.From, "to": msg.To, "text": msg.Text, "parent": msg.Parent}})
+	return queueFile, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayAll    bool
+	replaySpeed  float64
+	replayDryRun bool
+)
+
+// replayTargets は再投入するメッセージを投入順に返す
+func replayTargets(ml *messageLog, all bool) []*traceNode {
+	var targets []*traceNode
+	if all {
+		for _, n := range ml.Nodes {
+			targets = append(targets, n)
+		}
+	} else {
+		targets = append(targets, ml.Roots...)
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].EnqueuedAt.Before(targets[j].EnqueuedAt)
+	})
+	return targets
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <session>",
+	Short: "記録済みセッションの起点メッセージを現在のセッションに再投入する",
+	Long: `run/<session>/events.jsonlから起点メッセージ(親のないメッセージ。最初のCEOへの指示など)を取り出し、
+起動中のワーカーのキューに投入します。--allを付けるとロール間のすべてのメッセージを元のタイミングで再投入します。`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		session := args[0]
+		ml, err := loadMessageLog(sessionEventsPath(session))
+		if err != nil {
+			fmt.Println("events.jsonlが読み込めません:", err)
+			os.Exit(1)
+		}
+		if replaySpeed <= 0 {
+			fmt.Println("--speedには正の値を指定してください")
+			os.Exit(1)
+		}
+		targets := replayTargets(ml, replayAll)
+		if len(targets) == 0 {
+			fmt.Println("再投入するメッセージがありません")
+			return
+		}
+
+		if !replayDryRun {
+			// 同じセッションに再投入すると記録が混ざるため、新しいセッションを起動してから実行する
+			if latest, err := os.Readlink(latestDir); err == nil && filepath.Base(latest) == session {
+				fmt.Println("再生元のセッションが実行中です。新しいセッションでワーカーを起動してから実行してください")
+				os.Exit(1)
+			}
+			if ws, err := readWorkerStatus(); err != nil || time.Since(ws.UpdatedAt) > 5*time.Second {
+				fmt.Println("[WARN] ワーカーが起動していないようです。メッセージは次回起動時に処理されます")
+			}
+		}
+
+		// 系譜を保つため、元のIDから新しいIDへの対応を記録して親を置き換える
+		newIDs := map[string]string{}
+		start := targets[0].EnqueuedAt
+		replayStart := time.Now()
+		for _, n := range targets {
+			if replayAll {
+				wait := time.Duration(float64(n.EnqueuedAt.Sub(start))/replaySpeed) - time.Since(replayStart)
+				if wait > 0 && !replayDryRun {
+					time.Sleep(wait)
+				}
+			}
+			msg := queueMessage{
+				ID:     newMessageID(),
+				Parent: newIDs[n.Parent],
+				From:   n.From,
+				To:     n.To,
+				Text:   n.Text,
+			}
+			newIDs[n.ID] = msg.ID
+			if replayDryRun {
+				fmt.Printf("[REPLAY] +%s %s\n", formatElapsed(n.EnqueuedAt.Sub(start).Seconds()/replaySpeed), n.summary())
+				continue
+			}
+			if _, err := enqueueMessage(msg); err != nil {
+				fmt.Println("キューへの書き込み失敗:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("[REPLAY] %s → %s (%s ← %s) %s\n", msg.From, msg.To, msg.ID, n.ID, shorten(msg.Text, 60))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().BoolVar(&replayAll, "all", false, "ロール間のすべてのメッセージを元のタイミングで再投入する")
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "--all時の再生速度の倍率 (例: 2で2倍速)")
+	replayCmd.Flags().BoolVar(&replayDryRun, "dry-run", false, "投入せずに再投入するメッセージを表示する")
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"clampany/internal"
+	"clampany/internal/executor"
+	"clampany/internal/util"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// execRoles はconfig.yamlのrolesで定義した、ペインを持たないshell/humanロール
+var execRoles []internal.Role
+
+// workerRoles はワーカーモードの全ロール名(AIロール、shell/humanロールの順)を返す
+func workerRoles() []string {
+	roles := append([]string(nil), aiRoles...)
+	for _, r := range execRoles {
+		roles = append(roles, r.Name)
+	}
+	return roles
+}
+
+// isExecRole はロールがペインを持たないshell/humanロールかを返す
+func isExecRole(name string) bool {
+	for _, r := range execRoles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// roleExecutor はshell/humanロールの実行器を返す。
+// humanロールはclampany status set done --task <id> --role <role>で完了を報告する
+func roleExecutor(role internal.Role) internal.Executor {
+	if role.Type == internal.RoleHuman {
+		return &executor.HumanExecutor{Wait: func(ctx context.Context, t internal.Task, sent time.Time) (string, error) {
+			return waitHumanReport(ctx, role.Name, t.Name, sent)
+		}}
+	}
+	return &executor.ShellExecutor{}
+}
+
+// waitHumanReport はhumanロールからのタスクの完了報告を待つ
+func waitHumanReport(ctx context.Context, role, task string, since time.Time) (string, error) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+		st, err := readAgentStatus(role)
+		if err != nil || !st.UpdatedAt.After(since) || (st.Task != "" && st.Task != task) {
+			continue
+		}
+		switch {
+		case st.Cancelled:
+			return "", fmt.Errorf("タスクがキャンセルされました")
+		case st.State == agentIdle || st.State == agentDone:
+			return st.Response, nil
+		}
+	}
+}
+
+// runRoleExecutor はshell/humanロールのキューのメッセージを1件ずつ実行する。
+// 実行中の出力はトランスクリプトに記録し、最終的な出力を応答としてoutputs/に保存する
+func runRoleExecutor(role internal.Role, queue <-chan queueMessage) {
+	ex := roleExecutor(role)
+	for msg := range queue {
+		mu.Lock()
+		currentCommand[role.Name] = msg.Text
+		currentTask[role.Name] = msg.ID
+		currentMessage[role.Name] = msg
+		taskStartedAt[role.Name] = time.Now()
+		taskOffset[role.Name] = transcriptSize(role.Name)
+		delete(lastResponse, role.Name)
+		recordDelivery(role.Name, msg)
+		setRoleState(role.Name, "running")
+		mu.Unlock()
+
+		// --timeoutを指定したメッセージは時間を超えたら中断する。
+		// ダッシュボードからのキャンセルはステータスファイルで届く
+		timeout, _ := time.ParseDuration(msg.Timeout)
+		base, interrupt := context.WithCancel(context.Background())
+		ctx, cancel := base, interrupt
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(base, timeout)
+		}
+		finished := make(chan struct{})
+		go watchCancel(role.Name, msg.ID, time.Now(), interrupt, finished)
+		if role.Type == internal.RoleHuman {
+			util.Info("[HUMAN] %s (%s): %s\n  完了したら ./clampany status set done --task %s --role %s", msg.ID, role.Name, msg.Text, msg.ID, role.Name)
+		}
+		t := internal.Task{Name: msg.ID, Role: role.Name, Command: msg.Text, Prompt: msg.Text}
+		req := internal.ExecRequest{Task: t, ArtifactDir: filepath.Join(sessionDir, "artifacts", msg.ID)}
+		pr, pw := io.Pipe()
+		copied := make(chan struct{})
+		if f, err := os.OpenFile(transcriptPath(sessionDir, role.Name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+			go func() {
+				writeTranscript(pr, f)
+				f.Close()
+				close(copied)
+			}()
+			req.Stream = pw
+		} else {
+			close(copied)
+		}
+		res, err := ex.Execute(ctx, req)
+		close(finished)
+		cancel()
+		interrupt()
+		pw.Close()
+		<-copied
+		os.Remove(req.ArtifactDir)
+
+		response := strings.TrimSpace(res.Output)
+		if failure := execError(res, err); failure != "" {
+			response = strings.TrimSpace(response + "\n\n" + failure)
+			util.Fail("%s (%s): %s", msg.ID, role.Name, failure)
+		}
+		mu.Lock()
+		lastResponse[role.Name] = response
+		setRoleState(role.Name, "waiting")
+		mu.Unlock()
+	}
+}
+
+// watchCancel はロールのタスクにキャンセルが報告されたらinterruptを呼ぶ。finishedが閉じたら監視を終える
+func watchCancel(role, task string, since time.Time, interrupt context.CancelFunc, finished <-chan struct{}) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		}
+		st, err := readAgentStatus(role)
+		if err == nil && st.Cancelled && st.Task == task && st.UpdatedAt.After(since) {
+			interrupt()
+			return
+		}
+	}
+}
+
+// execError は実行結果の失敗を応答に添える文にする
+func execError(res internal.ExecResult, err error) string {
+	if err == nil {
+		return ""
+	}
+	if res.ExitCode != nil {
+		return fmt.Sprintf("[失敗] 終了コード %d: %v", *res.ExitCode, err)
+	}
+	return fmt.Sprintf("[失敗] %v", err)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatchCancel(t *testing.T) {
+	// ステータスファイルはカレントディレクトリのrun/latestに書かれる
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	ctx, interrupt := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	defer close(finished)
+	go watchCancel("build", "m1", time.Now(), interrupt, finished)
+
+	// 別のタスクのキャンセルでは止めない
+	if err := writeAgentStatus(agentStatus{Role: "build", State: agentIdle, Task: "m0", Cancelled: true, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("別のタスクのキャンセルで中断しました")
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	if err := writeAgentStatus(agentStatus{Role: "build", State: agentIdle, Task: "m1", Cancelled: true, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("キャンセルの報告で中断しませんでした")
+	}
+}
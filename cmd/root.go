@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"clampany/internal"
 	"clampany/internal/executor"
+	"clampany/internal/loader"
+	"clampany/internal/util"
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -62,22 +66,218 @@ var initCmd = &cobra.Command{
 			}
 			os.WriteFile("_clampany/instructions/"+fname, b, 0644)
 		}
+		os.MkdirAll(plansDir, 0755)
 		fmt.Println("_clampany/instructions ディレクトリを初期化しました")
+		switch initHooks {
+		case "":
+		case "claude":
+			if err := installClaudeHooks(); err != nil {
+				fmt.Println("[ERROR] Claude Codeのフック設定に失敗:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s にclampanyのフックを追加しました\n", claudeSettingsPath)
+		default:
+			fmt.Printf("[ERROR] 未対応のエージェントCLIです: %s (対応: claude)\n", initHooks)
+			os.Exit(1)
+		}
 	},
 }
 
-var engineerCount int
+var (
+	engineerCount int
+	initHooks     string
+	metricsAddr   string
+)
 
 // --- ステータス管理用グローバル変数 ---
 var (
 	mu              sync.Mutex
-	paneStatus      = map[string]string{} // ロールごとの状態: init/waiting/running
-	paneStatusCount = map[string]int{}    // ロールごとのwaiting回数
-	currentCommand  = map[string]string{} // ロールごとの現在のコマンド
-	runningCount    = map[string]int{}    // running回数
-	waitingCount    = map[string]int{}    // waiting回数
+	paneStatus      = map[string]string{}         // ロールごとの状態: init/waiting/running/blocked
+	paneStatusCount = map[string]int{}            // ロールごとのwaiting回数
+	currentCommand  = map[string]string{}         // ロールごとの現在のコマンド
+	currentTask     = map[string]string{}         // ロールごとの現在のタスクID
+	timelines       = map[string]*roleTimeline{}  // ロールごとの状態遷移(稼働時間の集計用)
+	currentMessage  = map[string]queueMessage{}   // ロールごとの実行中メッセージ
+	taskStartedAt   = map[string]time.Time{}      // ロールごとの現在のタスクの配信時刻
+	stallHandledAt  = map[string]time.Time{}      // ロールごとの停止への最終対処時刻
+	restartCount    = map[string]int{}            // ロールごとのエージェント再起動回数
+	taskOffset      = map[string]int64{}          // ロールごとの現在のタスク配信時のトランスクリプト位置
+	protocolActive  = map[string]bool{}           // ステータスプロトコルで報告済みのロール
+	completedAt     = map[string]time.Time{}      // ロールごとの最終完了時刻
+	lastResponse    = map[string]string{}         // ロールごとの最終応答(フック経由)
+	statusSince     = map[string]time.Time{}      // ロールごとの現在の状態になった時刻
+	completedCount  = map[string]int{}            // ロールごとの完了タスク数
+	pendingMessages = map[string][]queueMessage{} // キューごとの未配信メッセージ(engineerは共通キュー)
+	rolePanes       = map[string]string{}         // ロール名→ペインID
+	blockedMessage  = map[string]string{}         // blocked中のロールの通知内容(承認待ちなど)
+	recentMessages  []deliveredMessage            // 直近に配信したメッセージ(新しい順)
 )
 
+// 保持する配信履歴の件数
+const recentMessageLimit = 20
+
+// deliveredMessage はロールへの配信記録
+type deliveredMessage struct {
+	queueMessage
+	Role        string    `json:"role"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// recordDelivery は配信履歴に追加する。呼び出し側でmuを保持していること
+func recordDelivery(role string, msg queueMessage) {
+	messagesDelivered[role]++
+	util.Emit(util.Event{Type: "message.delivered", Role: role, MessageID: msg.ID})
+	recentMessages = append([]deliveredMessage{{queueMessage: msg, Role: role, DeliveredAt: time.Now()}}, recentMessages...)
+	if len(recentMessages) > recentMessageLimit {
+		recentMessages = recentMessages[:recentMessageLimit]
+	}
+}
+
+// エージェントCLIのフックが設定済みならペインの監視を行わない
+var hooksActive bool
+
+// ワーカーモードの設定(_clampany/config.yaml)
+var workerConfig = internal.DefaultConfig()
+
+// setRoleState はロールの状態を更新する。呼び出し側でmuを保持していること
+func setRoleState(role, status string) {
+	if paneStatus[role] == status {
+		return
+	}
+	now := time.Now()
+	util.Emit(util.Event{Type: "role.state", Role: role, MessageID: currentTask[role], Data: map[string]interface{}{"from": paneStatus[role], "to": status}})
+	paneStatus[role] = status
+	statusSince[role] = now
+	if t := timelines[role]; t != nil {
+		t.transition(utilCategory(status), now)
+	}
+	if status != "blocked" {
+		delete(blockedMessage, role)
+	}
+	switch status {
+	case "running":
+		if currentTask[role] != "" {
+			util.Emit(util.Event{Type: "task.started", Role: role, MessageID: currentTask[role]})
+		}
+	case "waiting":
+		if currentTask[role] != "" {
+			util.Emit(util.Event{Type: "task.completed", Role: role, MessageID: currentTask[role], Data: map[string]interface{}{"duration_seconds": now.Sub(taskStartedAt[role]).Seconds()}})
+			completedCount[role]++
+			observeTaskDuration(role, now.Sub(taskStartedAt[role]))
+			msg := currentMessage[role]
+			meta := taskOutputMeta{
+				Task:            currentTask[role],
+				Role:            role,
+				From:            msg.From,
+				Prompt:          currentCommand[role],
+				StartedAt:       taskStartedAt[role],
+				CompletedAt:     now,
+				DurationSeconds: now.Sub(taskStartedAt[role]).Seconds(),
+			}
+			go saveTaskOutput(meta, taskOffset[role], transcriptSize(role), lastResponse[role])
+		}
+		currentCommand[role] = ""
+		currentTask[role] = ""
+		delete(currentMessage, role)
+	}
+}
+
+// applyAgentStatus はエージェントの報告をロール状態に反映する。呼び出し側でmuを保持していること
+func applyAgentStatus(st agentStatus) {
+	// [READY]はプロトコルに対応していないエージェントも出力するため、画面からの推定を止めない
+	if st.Source != "ready" {
+		protocolActive[st.Role] = true
+	}
+	switch st.State {
+	case agentBusy:
+		setRoleState(st.Role, "running")
+	case agentBlocked:
+		setRoleState(st.Role, "blocked")
+		blockedMessage[st.Role] = st.Message
+	case agentIdle, agentDone:
+		// 以前のタスクに対する遅れた完了報告は無視する
+		if st.Task != "" && currentTask[st.Role] != "" && st.Task != currentTask[st.Role] {
+			return
+		}
+		if st.State == agentDone {
+			completedAt[st.Role] = st.UpdatedAt
+		}
+		if st.Cancelled {
+			// キャンセルしたタスクは完了数に数えない
+			currentTask[st.Role] = ""
+		}
+		if st.Response != "" {
+			lastResponse[st.Role] = st.Response
+			os.MkdirAll("run/latest/responses", 0755)
+			os.WriteFile(filepath.Join("run/latest/responses", st.Role+".md"), []byte(st.Response+"\n"), 0644)
+		}
+		setRoleState(st.Role, "waiting")
+	}
+}
+
+// watchAgentStatus はロールの状態を監視する。
+// ステータスファイルとトランスクリプトに出力されたマーカーを正とし、
+// プロトコルの報告がないロールに限り設定に応じてペイン出力から推定する。
+// フック設定済みの場合はフックが書くステータスファイルだけを見る
+func watchAgentStatus(role, paneID string) {
+	var lastApplied time.Time
+	var markerOffset int64
+	for {
+		if hooksActive {
+			if st, err := readAgentStatus(role); err == nil && st.UpdatedAt.After(lastApplied) {
+				lastApplied = st.UpdatedAt
+				mu.Lock()
+				applyAgentStatus(st)
+				mu.Unlock()
+			}
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		// 前回以降に出力されたマーカーのうち最後のものを採用する
+		markers, next := transcriptMarkers(role, markerOffset)
+		markerOffset = next
+		if len(markers) > 0 {
+			last := markers[len(markers)-1]
+			last.UpdatedAt = time.Now()
+			writeAgentStatus(last)
+		}
+
+		if st, err := readAgentStatus(role); err == nil && st.UpdatedAt.After(lastApplied) {
+			lastApplied = st.UpdatedAt
+			mu.Lock()
+			applyAgentStatus(st)
+			mu.Unlock()
+		} else if workerConfig.Status.ScrapeFallback {
+			out, err := exec.Command("tmux", "capture-pane", "-t", paneID, "-p", "-S", "-").Output()
+			if err == nil {
+				lines := strings.Split(string(out), "\n")
+				// 直近1000行にScrapePatternがあればrunning, なければwaiting
+				if len(lines) > 1000 {
+					lines = lines[len(lines)-1000:]
+				}
+				found := false
+				for _, line := range lines {
+					cleanLine := ansiRegexp.ReplaceAllString(line, "")
+					if strings.Contains(cleanLine, workerConfig.Status.ScrapePattern) {
+						found = true
+						break
+					}
+				}
+				mu.Lock()
+				if !protocolActive[role] {
+					if found {
+						setRoleState(role, "running")
+					} else if paneStatus[role] == "running" {
+						setRoleState(role, "waiting")
+					}
+				}
+				mu.Unlock()
+			}
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
 var aiRoles []string // ←グローバルに移動
 
 // 埋め込み→外部ファイルの順で読む関数
@@ -103,11 +303,17 @@ func getClaudeCommand(role string) string {
 	default:
 		inst = "engineer.md"
 	}
-	return fmt.Sprintf(`claude --dangerously-skip-permissions "$(cat _clampany/instructions/%s _clampany/instructions/sufix.md)"`, inst)
+	// CLAMPANY_ROLEはclampany status setやinqueueが自ロールを知るために使う
+	return fmt.Sprintf(`CLAMPANY_ROLE=%s claude --dangerously-skip-permissions "$(cat _clampany/instructions/%s _clampany/instructions/sufix.md)"`, role, inst)
 }
 
 // --- 追加: tmuxペイン生成とコマンド送信 ---
 func createRolePane(role, label, splitDir string, isFirst bool, basePane string) (string, error) {
+	return createPane(role, label, splitDir, isFirst, basePane, getClaudeCommand(role))
+}
+
+// createPane はロールのペインを用意してトランスクリプトを記録させ、cmdStrでエージェントを起動する
+func createPane(role, label, splitDir string, isFirst bool, basePane, cmdStr string) (string, error) {
 	var paneID string
 	var err error
 	if isFirst {
@@ -121,8 +327,10 @@ func createRolePane(role, label, splitDir string, isFirst bool, basePane string)
 		paneID = strings.TrimSpace(string(out))
 	}
 	exec.Command("tmux", "select-pane", "-t", paneID, "-T", label).Run()
-
-	cmdStr := getClaudeCommand(role)
+	util.Emit(util.Event{Type: "pane.created", Role: role, Data: map[string]interface{}{"pane_id": paneID}})
+	if err := startTranscript(role, paneID); err != nil {
+		log.Printf("transcript pipe failed: %v", err)
+	}
 
 	// send-keys に渡すときはクォートで囲むと安全
 	err = exec.Command("tmux", "send-keys", "-t", paneID, cmdStr, "C-m").Run()
@@ -147,6 +355,30 @@ func startPersistentWorkers() {
 		}
 	}
 	os.MkdirAll("_clampany/queue", 0755)
+	cfg, err := loader.LoadConfig("_clampany/config.yaml")
+	if err != nil {
+		fmt.Println("_clampany/config.yamlの読み込み失敗:", err)
+		os.Exit(1)
+	}
+	workerConfig = cfg
+	execRoles = cfg.Roles
+	hooksActive = claudeHooksInstalled()
+	if hooksActive {
+		fmt.Println("[Clampany] Claude Codeのフックでロール状態を取得します")
+	}
+	if err := startSession(); err != nil {
+		fmt.Println("セッションディレクトリの作成失敗:", err)
+		os.Exit(1)
+	}
+	fmt.Println("[Clampany] セッション:", sessionDir)
+	util.Emit(util.Event{Type: "session.started", Data: map[string]interface{}{"session": filepath.Base(sessionDir)}})
+	util.Emit(util.Event{Type: "config.loaded", Data: map[string]interface{}{"path": "_clampany/config.yaml", "hooks": hooksActive}})
+	if metricsAddr != "" {
+		if err := startMetricsServer(metricsAddr); err != nil {
+			fmt.Println("メトリクスの待ち受けに失敗:", err)
+			os.Exit(1)
+		}
+	}
 	aiRoles = []string{} // ←ここで初期化
 	entries, err := readInstructionDir()
 	if err == nil {
@@ -206,9 +438,22 @@ func startPersistentWorkers() {
 	for _, role := range aiRoles {
 		mu.Lock()
 		paneStatus[role] = "init"
+		statusSince[role] = time.Now()
+		timelines[role] = &roleTimeline{}
+		timelines[role].transition(utilCategory("init"), statusSince[role])
 		currentCommand[role] = ""
-		runningCount[role] = 0
-		waitingCount[role] = 0
+		currentTask[role] = ""
+		mu.Unlock()
+	}
+	// shell/humanロールはペインを持たず、すぐに受け付けられる
+	for _, r := range execRoles {
+		mu.Lock()
+		paneStatus[r.Name] = "waiting"
+		statusSince[r.Name] = time.Now()
+		timelines[r.Name] = &roleTimeline{}
+		timelines[r.Name].transition(utilCategory("waiting"), statusSince[r.Name])
+		currentCommand[r.Name] = ""
+		currentTask[r.Name] = ""
 		mu.Unlock()
 	}
 
@@ -240,8 +485,12 @@ func startPersistentWorkers() {
 	exec.Command("tmux", "select-pane", "-L").Run()
 	exec.Command("tmux", "select-pane", "-L").Run()
 
-	// 4. split-window -v（左列を下に分割、2ペイン目＝監視用）
-	cmd = exec.Command("tmux", "split-window", "-v", "-P", "-F", "#{pane_id}", "watch -n 1 cat run/latest/pane_status.txt")
+	// 4. split-window -v（左列を下に分割、2ペイン目＝ダッシュボード）
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "./clampany"
+	}
+	cmd = exec.Command("tmux", "split-window", "-v", "-P", "-F", "#{pane_id}", fmt.Sprintf("%q dashboard", exe))
 	out, err = cmd.Output()
 	if err != nil {
 		fmt.Println("tmux左列監視ペイン作成失敗:", err)
@@ -323,6 +572,12 @@ func startPersistentWorkers() {
 	// 右列均等割り
 	exec.Command("bash", "-c", `left=$(tmux list-panes -F "#{pane_left}" | sort -n | uniq | sed -n 2p); panes=($(tmux list-panes -F "#{pane_id} #{pane_left}" | awk -v l="$left" '$2 == l {print $1}')); h=$(tmux display -p "#{window_height}"); eh=$((h / ${#panes[@]})); for p in "${panes[@]}"; do tmux resize-pane -t "$p" -y "$eh"; done`).Run()
 
+	mu.Lock()
+	for role, pane := range paneMap {
+		rolePanes[role] = pane
+	}
+	mu.Unlock()
+
 	// 5. panes.json保存
 	os.MkdirAll("run/latest", 0755)
 	f, _ := os.Create("run/latest/panes.json")
@@ -332,19 +587,24 @@ func startPersistentWorkers() {
 	fmt.Println("[Clampany] 全ロール永続ワーカー起動中。Ctrl+Cで終了")
 
 	// 6. 各ロールごとに<role>_queue.mdを監視し、指示を自分のキューに流し込む
-	queues := map[string]chan string{}
+	queues := map[string]chan queueMessage{}
+	queueRoles := []string{}
 	for _, role := range aiRoles {
-		queues[role] = make(chan string, 100)
+		queues[role] = make(chan queueMessage, 100)
+		if !strings.HasPrefix(role, "engineer") {
+			queueRoles = append(queueRoles, role)
+		}
+	}
+	for _, r := range execRoles {
+		queues[r.Name] = make(chan queueMessage, 100)
+		queueRoles = append(queueRoles, r.Name)
 	}
 
 	// --- 追加: _clampany/queue/<role>_queue*.md を監視し、内容をチャネルに流し込む ---
-	for _, role := range aiRoles {
-		if strings.HasPrefix(role, "engineer") {
-			continue
-		}
+	for _, role := range queueRoles {
 		go func(role string) {
 			fileSizes := map[string]int64{}
-			pendingLines := []string{}
+			pendingLines := []queueMessage{}
 			for {
 				pattern := fmt.Sprintf("_clampany/queue/%s_queue*.md", role)
 				files, err := filepath.Glob(pattern)
@@ -363,7 +623,12 @@ func startPersistentWorkers() {
 									for _, line := range lines {
 										line = strings.TrimSpace(line)
 										if line != "" {
-											pendingLines = append(pendingLines, line)
+											msg := parseQueueLine(line, role)
+											pendingLines = append(pendingLines, msg)
+											util.Emit(util.Event{Type: "message.received", Role: role, MessageID: msg.ID, Data: map[string]interface{}{"queue": role}})
+											mu.Lock()
+											messagesEnqueued[role]++
+											mu.Unlock()
 										}
 									}
 									fileSizes[queueFile] = fi.Size()
@@ -379,9 +644,13 @@ func startPersistentWorkers() {
 				status := paneStatus[role]
 				mu.Unlock()
 				if status == "waiting" && len(pendingLines) > 0 {
+					util.Emit(util.Event{Type: "message.routed", Role: role, MessageID: pendingLines[0].ID})
 					queues[role] <- pendingLines[0]
 					pendingLines = pendingLines[1:]
 				}
+				mu.Lock()
+				pendingMessages[role] = append([]queueMessage(nil), pendingLines...)
+				mu.Unlock()
 				time.Sleep(1 * time.Second)
 			}
 		}(role)
@@ -390,7 +659,7 @@ func startPersistentWorkers() {
 	// --- engineer専用の共通キュー監視 ---
 	go func() {
 		fileSizes := map[string]int64{}
-		var pendingLines []string
+		var pendingLines []queueMessage
 		for {
 			pattern := "_clampany/queue/engineer_queue*.md"
 			files, err := filepath.Glob(pattern)
@@ -408,7 +677,12 @@ func startPersistentWorkers() {
 								for _, line := range lines {
 									line = strings.TrimSpace(line)
 									if line != "" {
-										pendingLines = append(pendingLines, line)
+										msg := parseQueueLine(line, "engineer")
+										pendingLines = append(pendingLines, msg)
+										util.Emit(util.Event{Type: "message.received", MessageID: msg.ID, Data: map[string]interface{}{"queue": "engineer"}})
+										mu.Lock()
+										messagesEnqueued["engineer"]++
+										mu.Unlock()
 									}
 								}
 								fileSizes[queueFile] = fi.Size()
@@ -420,13 +694,14 @@ func startPersistentWorkers() {
 				}
 			}
 
-			newPending := []string{}
+			newPending := []queueMessage{}
 			for _, line := range pendingLines {
 				assigned := false
 
 				mu.Lock()
 				for _, r := range aiRoles {
 					if strings.HasPrefix(r, "engineer") && paneStatus[r] == "waiting" {
+						util.Emit(util.Event{Type: "message.routed", Role: r, MessageID: line.ID})
 						queues[r] <- line
 						assigned = true
 						break
@@ -441,6 +716,9 @@ func startPersistentWorkers() {
 
 			// pendingLinesを置き換え
 			pendingLines = newPending
+			mu.Lock()
+			pendingMessages["engineer"] = append([]queueMessage(nil), pendingLines...)
+			mu.Unlock()
 
 			time.Sleep(1 * time.Second)
 		}
@@ -449,147 +727,42 @@ func startPersistentWorkers() {
 	// 7. 各ロールごとに永続ワーカー起動
 	for _, role := range aiRoles {
 		go func(role string) {
+			// Waitを指定しないため送信だけして戻る
 			execAI := &executor.AIExecutor{PaneID: paneMap[role]}
-			for prompt := range queues[role] {
-				mu.Lock()
-				currentCommand[role] = prompt
-				paneStatus[role] = "running"
-				runningCount[role]++
-				mu.Unlock()
-				execAI.Execute(prompt)
+			for msg := range queues[role] {
 				mu.Lock()
-				paneStatus[role] = "waiting"
-				waitingCount[role]++
-				currentCommand[role] = ""
+				currentCommand[role] = msg.Text
+				currentTask[role] = msg.ID
+				currentMessage[role] = msg
+				taskStartedAt[role] = time.Now()
+				taskOffset[role] = transcriptSize(role)
+				delete(lastResponse, role)
+				recordDelivery(role, msg)
+				setRoleState(role, "running")
 				mu.Unlock()
+				// 完了はエージェントの報告(またはフォールバック判定)でwaitingに戻る
+				execAI.Execute(context.Background(), internal.ExecRequest{Task: internal.Task{Name: msg.ID, Role: role, Prompt: msg.Text}})
 			}
 		}(role)
 	}
+	for _, r := range execRoles {
+		go runRoleExecutor(r, queues[r.Name])
+	}
 
-	// --- 追加: 各ワーカーの標準出力を監視し、[READY]が出力されたらinit→waitingに遷移 ---
+	// --- 各ロールの状態報告を監視 ---
 	for _, role := range aiRoles {
-		paneID := paneMap[role]
-		go func(role, paneID string) {
-			for {
-				out, err := exec.Command("tmux", "capture-pane", "-t", paneID, "-p", "-S", "-1000").Output()
-				if err == nil {
-					lines := strings.Split(string(out), "\n")
-					for _, line := range lines {
-						cleanLine := ansiRegexp.ReplaceAllString(line, "")
-						if strings.Contains(cleanLine, "[READY]") {
-							mu.Lock()
-							if paneStatus[role] == "init" {
-								paneStatus[role] = "waiting"
-							}
-							mu.Unlock()
-						}
-					}
-				}
-				time.Sleep(1 * time.Second)
-
-				// すでにwaitingになっていたら終了
-				mu.Lock()
-				if paneStatus[role] == "waiting" {
-					mu.Unlock()
-					break
-				}
-				mu.Unlock()
-			}
-		}(role, paneID)
+		go watchAgentStatus(role, paneMap[role])
 	}
 
-	// --- 追加: tokens表示中はrunning, それ以外はwaitingに遷移 ---
+	// --- running/blockedのまま止まったロールの検出 ---
 	for _, role := range aiRoles {
-		paneID := paneMap[role]
-		go func(role, paneID string) {
-			for {
-				out, err := exec.Command("tmux", "capture-pane", "-t", paneID, "-p", "-S", "-1000").Output()
-				if err == nil {
-					lines := strings.Split(string(out), "\n")
-					foundTokens := false
-					for _, line := range lines {
-						cleanLine := ansiRegexp.ReplaceAllString(line, "")
-						if strings.Contains(cleanLine, "tokens") {
-							foundTokens = true
-							break
-						}
-					}
-					mu.Lock()
-					if foundTokens {
-						if paneStatus[role] != "running" {
-							paneStatus[role] = "running"
-						}
-					} else {
-						if paneStatus[role] == "running" {
-							paneStatus[role] = "waiting"
-						}
-					}
-					mu.Unlock()
-				}
-				time.Sleep(1 * time.Second)
-			}
-		}(role, paneID)
+		go watchStall(role, paneMap[role])
 	}
 
-	// ステータスファイル出力用関数
-	writeStatus := func() {
-		os.MkdirAll("run/latest", 0755)
-		f, _ := os.Create("run/latest/pane_status.txt")
-		defer f.Close()
-
-		// ロール順固定: aiRolesの順番で出力
-		roles := aiRoles
-
-		for _, role := range roles {
-			mu.Lock()
-			status := paneStatus[role]
-			cmd := currentCommand[role]
-			runCnt := runningCount[role]
-			waitCnt := waitingCount[role]
-			mu.Unlock()
-
-			// 稼働率計算
-			total := runCnt + waitCnt
-			var rate int
-			if status == "waiting" {
-				rate = 0
-			} else if total > 0 {
-				rate = int(float64(runCnt) / float64(total) * 100)
-			} else {
-				rate = 0
-			}
-			barLen := 10
-			barFill := int(float64(rate) / 100 * float64(barLen))
-			bar := strings.Repeat("█", barFill) + strings.Repeat("░", barLen-barFill)
-
-			// 状態アイコン
-			icon := "⚪"
-			switch status {
-			case "running":
-				icon = "🟢"
-			case "waiting":
-				icon = "🟡"
-			case "init":
-				icon = "⚪"
-			}
-
-			// コマンド表示
-			cmdDisp := cmd
-			if cmdDisp == "" {
-				if status == "init" {
-					cmdDisp = "(初期化中)"
-				} else {
-					cmdDisp = "(待機中)"
-				}
-			}
-
-			fmt.Fprintf(f, "[%-9s]%s %-8s | コマンド: %-20s | 稼働率: %s %3d%%\n", role, icon, status, cmdDisp, bar, rate)
-		}
-	}
 	// ステータスファイルを定期的に更新
 	go func() {
 		for {
-			writeStatus()
+			writeStatusFiles()
 			time.Sleep(1 * time.Second)
 		}
 	}()
@@ -598,6 +771,9 @@ func startPersistentWorkers() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
+	// 終了時点の稼働時間をセッションに保存する
+	writeStatusFiles()
+	util.Emit(util.Event{Type: "session.stopped"})
 	fmt.Println("[Clampany] 終了します")
 }
 
@@ -634,6 +810,9 @@ func Execute() error {
 // build時にinstructionsディレクトリがなければ作成
 func init() {
 	os.MkdirAll("_clampany/queue", 0755)
+	util.SetEventLog(eventsPath)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Prometheus/OpenMetrics形式のメトリクスを公開するアドレス (例: --metrics-addr :9464。ループバックのアドレスのみ)")
+	initCmd.Flags().StringVar(&initHooks, "hooks", "", "エージェントCLIのフック設定をインストールする (例: --hooks claude)")
 	rootCmd.PersistentFlags().IntVar(&engineerCount, "engineer", 0, "追加するengineerロールの数 (例: --engineer 3 でengineer1,engineer2,engineer3)")
 }
@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+// パッケージのinitがカレントディレクトリに作る空の_clampany/queueを残さない
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Remove("_clampany/queue")
+	os.Remove("_clampany")
+	os.Exit(code)
+}
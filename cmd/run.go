@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"clampany/internal"
+	"clampany/internal/executor"
+	"clampany/internal/loader"
+	"clampany/internal/scheduler"
+	"clampany/internal/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// エージェントが起動して準備完了を報告するまで待つ時間
+const agentStartTimeout = 30 * time.Second
+
+// キャッシュの保存先。セッションをまたいで使う
+const runCacheDir = "run/cache"
+
+var (
+	runRolesPath string
+	runParallel  int
+	runFrom      string
+	runOnly      string
+	runNoCache   bool
+	runDryRun    bool
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <tasks.yaml>",
+	Short: "tasks.yamlの依存関係グラフを実行する",
+	Long: `tasks.yamlとroles.yamlを読み込んで検証し、run/<run-id>ディレクトリを作成して
+依存関係の順にタスクを実行します。各タスクの出力はrun/<run-id>/outputs/<task>.md、
+結果はrun/<run-id>/run.yamlに保存されます。`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if runParallel < 1 {
+			fmt.Println("--parallelには1以上を指定してください")
+			os.Exit(1)
+		}
+		tasks, roles, err := loader.LoadAndValidate(args[0], runRolesPath)
+		if err != nil {
+			fmt.Println("タスク・ロール定義にエラーがあります:")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cfg, err := loader.LoadConfig("_clampany/config.yaml")
+		if err != nil {
+			fmt.Println("_clampany/config.yamlの読み込み失敗:", err)
+			os.Exit(1)
+		}
+		roleTypes := map[string]internal.RoleType{}
+		for _, r := range roles {
+			roleTypes[r.Name] = r.Type
+		}
+		for asker, target := range cfg.Clarification.Roles {
+			if _, ok := roleTypes[target]; !ok {
+				fmt.Printf("clarification.roles.%s: 不明なロールです: %s\n", asker, target)
+				os.Exit(1)
+			}
+		}
+		tasks, err = scheduler.ExpandTasks(tasks)
+		if err != nil {
+			fmt.Println("タスクの展開に失敗:", err)
+			os.Exit(1)
+		}
+		if len(tasks) == 0 {
+			fmt.Println("実行するタスクがありません")
+			return
+		}
+		if runFrom != "" && runOnly != "" {
+			fmt.Println("--fromと--onlyは同時に指定できません")
+			os.Exit(1)
+		}
+		// --onlyは依存タスクの出力をキャッシュから取るため、キャッシュなしでは実行できない
+		if runOnly != "" && runNoCache {
+			fmt.Println("--onlyと--no-cacheは同時に指定できません (--onlyは依存タスクの出力をキャッシュから取ります)")
+			os.Exit(1)
+		}
+		var force, cacheOnly map[string]bool
+		if runFrom != "" {
+			names := scheduler.ResolveTaskNames(tasks, runFrom)
+			if len(names) == 0 {
+				fmt.Printf("タスク %s が見つかりません\n", runFrom)
+				os.Exit(1)
+			}
+			// 指定したタスクとそれに依存するタスクはキャッシュを使わずに実行する
+			force = scheduler.Descendants(tasks, names)
+		}
+		if runOnly != "" {
+			names := scheduler.ResolveTaskNames(tasks, runOnly)
+			if len(names) == 0 {
+				fmt.Printf("タスク %s が見つかりません\n", runOnly)
+				os.Exit(1)
+			}
+			// 指定したタスクだけを実行し、依存するタスクの出力はキャッシュから取る
+			force = map[string]bool{}
+			for _, name := range names {
+				force[name] = true
+			}
+			cacheOnly = scheduler.Ancestors(tasks, names)
+			var selected []internal.Task
+			for _, t := range tasks {
+				if force[t.Name] || cacheOnly[t.Name] {
+					selected = append(selected, t)
+				}
+			}
+			tasks = selected
+		}
+		if runDryRun {
+			printRunPlan(tasks, roles, cfg.Clarification, force, cacheOnly)
+			return
+		}
+
+		// AIタスクがある場合はロールごとの永続ペインで実行する。
+		// 確認に回答するAIロールのペインも用意する
+		aiUsed := map[string]bool{}
+		for _, t := range tasks {
+			if roleTypes[t.Role] != internal.RoleAI {
+				continue
+			}
+			aiUsed[t.Role] = true
+			if target, ok := scheduler.ClarificationTarget(cfg.Clarification, t.Role); ok && roleTypes[target] == internal.RoleAI {
+				aiUsed[target] = true
+			}
+		}
+		if len(aiUsed) > 0 && os.Getenv("TMUX") == "" {
+			fmt.Println("AIタスクを実行するにはtmux上で起動してください")
+			os.Exit(1)
+		}
+		// runはrun/latestを付け替えるため、ワーカーの状態・イベント・出力を奪わないよう同時には実行しない
+		if ws, err := readWorkerStatus(); err == nil && time.Since(ws.UpdatedAt) < 5*time.Second {
+			fmt.Println("ワーカーが起動中です。終了してから実行してください")
+			os.Exit(1)
+		}
+
+		// run/<run-id>を作成し、run/latestをそこに向ける
+		if err := startSession(); err != nil {
+			fmt.Println("runディレクトリの作成失敗:", err)
+			os.Exit(1)
+		}
+		runDir := sessionDir
+		id := filepath.Base(runDir)
+		if err := util.SetLogFile(filepath.Join(runDir, "run.log")); err == nil {
+			defer util.CloseLogFile()
+		}
+		util.Info("run %s: %d件のタスク (並列数 %d)", id, len(tasks), runParallel)
+
+		taskPtrs := make([]*internal.Task, len(tasks))
+		for i := range tasks {
+			taskPtrs[i] = &tasks[i]
+		}
+		execMap := map[string]internal.Executor{}
+		if len(aiUsed) > 0 {
+			panes, err := startDAGPanes(sortedKeys(aiUsed))
+			if err != nil {
+				fmt.Println("ペインの起動失敗:", err)
+				os.Exit(1)
+			}
+			for role, paneID := range panes {
+				execMap[role] = &paneTaskExecutor{Role: role, PaneID: paneID}
+			}
+		}
+		for _, r := range roles {
+			if r.Type == internal.RoleHuman {
+				execMap[r.Name] = humanTaskExecutor(r.Name)
+			}
+		}
+
+		s := scheduler.New(runParallel)
+		s.Force = force
+		s.CacheOnly = cacheOnly
+		s.Clarification = cfg.Clarification
+		if !runNoCache {
+			s.Cache = &scheduler.Cache{Dir: runCacheDir}
+		}
+		err = s.Run(taskPtrs, execMap, runDir, nil, roles)
+		if err != nil {
+			util.Fail("run %s: %v (%s)", id, err, filepath.Join(runDir, "run.yaml"))
+			os.Exit(1)
+		}
+		util.Success("run %s: すべてのタスクが完了しました (%s)", id, filepath.Join(runDir, "run.yaml"))
+	},
+}
+
+// printRunPlan は実行せずに段ごとのタスクと展開後のprompt/commandを表示する
+func printRunPlan(tasks []internal.Task, roles []internal.Role, clar internal.ClarificationConfig, force, cacheOnly map[string]bool) {
+	roleTypes := map[string]internal.RoleType{}
+	for _, r := range roles {
+		roleTypes[r.Name] = r.Type
+	}
+	byName := map[string]internal.Task{}
+	for _, t := range tasks {
+		byName[t.Name] = t
+	}
+	levels := scheduler.Levels(tasks)
+	fmt.Printf("[PLAN] %d件のタスク / %d段 (並列数 %d)\n", len(tasks), len(levels), runParallel)
+	for i, names := range levels {
+		fmt.Printf("\n段 %d\n", i+1)
+		for _, name := range names {
+			t := byName[name]
+			executor := string(roleTypes[t.Role])
+			if roleTypes[t.Role] == internal.RoleAI {
+				executor = "ai, ペイン"
+			}
+			fmt.Printf("  %s  %s (%s)\n", t.Name, t.Role, executor)
+			if len(t.DependsOn) > 0 {
+				fmt.Printf("    depends_on: %s\n", strings.Join(t.DependsOn, ", "))
+			}
+			if t.When != "" {
+				fmt.Printf("    when: %s\n", t.When)
+			}
+			if t.Retries > 0 || t.Timeout > 0 {
+				fmt.Printf("    retries: %d  timeout: %s\n", t.Retries, t.Timeout)
+			}
+			if target, ok := scheduler.ClarificationTarget(clar, t.Role); ok && roleTypes[t.Role] == internal.RoleAI && clar.MaxRounds > 0 {
+				fmt.Printf("    確認: %s (最大%d回)\n", target, clar.MaxRounds)
+			}
+			switch {
+			case cacheOnly[t.Name]:
+				fmt.Println("    キャッシュの出力を使う")
+			case force[t.Name]:
+				fmt.Println("    キャッシュを使わずに実行する")
+			case runNoCache || t.NoCache:
+				fmt.Println("    キャッシュなし")
+			}
+			rendered, err := scheduler.PreviewTask(t, tasks, filepath.Join("run", "<run-id>"))
+			if err != nil {
+				fmt.Printf("    展開エラー: %v\n", err)
+				continue
+			}
+			if rendered.Command != "" {
+				fmt.Printf("    command:\n%s\n", indent(rendered.Command, "      "))
+			}
+			if rendered.Prompt != "" {
+				fmt.Printf("    prompt:\n%s\n", indent(rendered.Prompt, "      "))
+				if !strings.Contains(t.Prompt, "{{") && len(t.DependsOn) > 0 {
+					fmt.Println("      (依存タスクの出力が末尾に付きます)")
+				}
+			}
+		}
+	}
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// humanTaskExecutor はDAGのhumanロールの実行器を返す。
+// 指示を表示し、clampany status set done --task <タスク名> --role <role>で完了が報告されるまで待つ
+func humanTaskExecutor(role string) internal.Executor {
+	return &executor.HumanExecutor{Wait: func(ctx context.Context, t internal.Task, sent time.Time) (string, error) {
+		util.Info("[HUMAN] %s (%s): %s\n  完了したら ./clampany status set done --task %s --role %s", t.Name, role, t.Prompt, t.Name, role)
+		return waitHumanReport(ctx, role, t.Name, sent)
+	}}
+}
+
+// startDAGPanes はAIロールごとにエージェントのペインを起動し、準備完了の報告があるまで待つ
+func startDAGPanes(roles []string) (map[string]string, error) {
+	// 指示はrunディレクトリに書き出し、_clampany/instructionsには依存しない
+	persona, err := filepath.Abs(filepath.Join(sessionDir, "persona.md"))
+	if err == nil {
+		err = os.WriteFile(persona, dagPersona, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("エージェントへの指示を書き込めません: %w", err)
+	}
+	started := time.Now()
+	panes := map[string]string{}
+	for _, role := range roles {
+		paneID, err := createPane(role, role, "-v", false, "", dagAgentCommand(role, persona))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", role, err)
+		}
+		panes[role] = paneID
+		exec.Command("tmux", "select-layout", "tiled").Run()
+	}
+	f, err := os.Create(filepath.Join(sessionDir, "panes.json"))
+	if err == nil {
+		json.NewEncoder(f).Encode(panes)
+		f.Close()
+	}
+
+	deadline := time.Now().Add(agentStartTimeout)
+	hooks := claudeHooksInstalled()
+	for role, paneID := range panes {
+		if err := waitAgentReady(role, paneID, hooks, started, deadline); err != nil {
+			return nil, err
+		}
+	}
+	return panes, nil
+}
+
+// waitAgentReady はエージェントが起動時の指示を読み終えて入力待ちになったことの報告を待つ。
+// 起動時の[READY]やStopフックが最初のタスクの完了と取り違えられないよう、タスクはこの後に送る。
+// フックがあればStopフックの報告を待つ([READY]の出力の後に届くため)
+func waitAgentReady(role, paneID string, hooks bool, since, deadline time.Time) error {
+	var offset int64
+	for {
+		if st, err := readAgentStatus(role); err == nil && st.UpdatedAt.After(since) && agentReady(st, hooks) {
+			return nil
+		}
+		if !hooks {
+			var markers []agentStatus
+			markers, offset = transcriptMarkers(role, offset)
+			for _, st := range markers {
+				if agentReady(st, hooks) {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			if paneHealth(paneID) != "ok" {
+				return fmt.Errorf("%s: エージェントが起動しません", role)
+			}
+			return fmt.Errorf("%s: エージェントが準備完了([READY])を報告しません", role)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// agentReady は報告が起動後の入力待ちを表すかを返す
+func agentReady(st agentStatus, hooks bool) bool {
+	if st.State != agentIdle && st.State != agentDone {
+		return false
+	}
+	return !hooks || st.Source == "hook"
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().StringVar(&runRolesPath, "roles", "roles.yaml", "ロール定義ファイル")
+	runCmd.Flags().IntVar(&runParallel, "parallel", 2, "同時に実行するタスク数の上限")
+	runCmd.Flags().StringVar(&runFrom, "from", "", "指定したタスクとそれに依存するタスクをキャッシュを使わずに実行する")
+	runCmd.Flags().StringVar(&runOnly, "only", "", "指定したタスクだけを実行する (依存するタスクの出力はキャッシュから取る)")
+	runCmd.Flags().BoolVar(&runNoCache, "no-cache", false, "キャッシュを使わずにすべてのタスクを実行する")
+	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "実行せずに実行計画と展開後のprompt/commandを表示する")
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import "testing"
+
+func TestAgentReady(t *testing.T) {
+	tests := []struct {
+		name  string
+		st    agentStatus
+		hooks bool
+		want  bool
+	}{
+		{name: "[READY]", st: agentStatus{State: agentIdle, Source: "ready"}, want: true},
+		{name: "CLIのidle", st: agentStatus{State: agentIdle, Source: "cli"}, want: true},
+		{name: "busy", st: agentStatus{State: agentBusy, Source: "marker"}, want: false},
+		// フックがあればStopフックは[READY]の後に届くため、フックの報告まで待つ
+		{name: "フックありで[READY]", st: agentStatus{State: agentIdle, Source: "ready"}, hooks: true, want: false},
+		{name: "フックありでStopフック", st: agentStatus{State: agentDone, Source: "hook"}, hooks: true, want: true},
+		{name: "フックありでpromptフック", st: agentStatus{State: agentBusy, Source: "hook"}, hooks: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := agentReady(tt.st, tt.hooks); got != tt.want {
+				t.Errorf("agentReady = %v, 期待は %v", got, tt.want)
+			}
+		})
+	}
+}
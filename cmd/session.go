@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	latestDir  = "run/latest"
+	eventsPath = "run/latest/events.jsonl"
+)
+
+// sessionDir はワーカー起動ごとに作るrun/<session>ディレクトリ
+var sessionDir string
+
+// startSession はrun/<session>を作成し、run/latestをそこへのシンボリックリンクにする
+func startSession() error {
+	id, err := createSessionDir("run", time.Now())
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join("run", id)
+	if fi, err := os.Lstat(latestDir); err == nil {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(latestDir); err != nil {
+				return err
+			}
+		} else {
+			// 以前のバージョンが作ったrun/latestディレクトリは退避する
+			if err := os.Rename(latestDir, filepath.Join("run", "legacy-"+id)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Symlink(id, latestDir); err != nil {
+		return err
+	}
+	sessionDir = dir
+	return nil
+}
+
+// createSessionDir はparentの下にセッションのディレクトリを作り、そのIDを返す。
+// 同じ秒に起動した別のセッションと共有しないよう、既にあれば-2, -3...を付けて作り直す
+func createSessionDir(parent string, now time.Time) (string, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	base := now.Format("20060102-150405")
+	for i := 1; ; i++ {
+		id := base
+		if i > 1 {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		// Mkdirは既存のディレクトリがあれば失敗するため、同時に起動しても同じIDにはならない
+		err := os.Mkdir(filepath.Join(parent, id), 0755)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateSessionDir(t *testing.T) {
+	parent := t.TempDir()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	// 同じ秒に起動したセッションは別のディレクトリになる
+	want := []string{"20260101-120000", "20260101-120000-2", "20260101-120000-3"}
+	for _, w := range want {
+		id, err := createSessionDir(parent, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != w {
+			t.Errorf("id = %s, 期待は %s", id, w)
+		}
+	}
+	id, err := createSessionDir(parent, now.Add(time.Second))
+	if err != nil || id != "20260101-120001" {
+		t.Errorf("id = %s, %v", id, err)
+	}
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"clampany/internal"
+	"clampany/internal/util"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 停止の分類
+const (
+	stallWaitingInput = "waiting_input" // 入力・確認待ち
+	stallNoOutput     = "no_output"     // 出力に変化がない
+	stallError        = "error"         // エラー表示で止まっている
+	stallLongRunning  = "long_running"  // 出力は続いているが終わらない
+)
+
+// 停止判定の間隔と、出力に変化がないとみなすまでの時間
+const (
+	stallCheckInterval = 10 * time.Second
+	stallQuietPeriod   = 2 * time.Minute
+)
+
+var (
+	stallInputRegexp = regexp.MustCompile(`(?i)(do you want|\(y/n\)|\[y/n\]|press enter|waiting for your input|needs your permission|❯ 1\.)`)
+	stallErrorRegexp = regexp.MustCompile(`(?i)(error|failed|panic|exception|rate limit)`)
+)
+
+// classifyStall はペインの末尾とその変化から停止の種類を推定する
+func classifyStall(tail []string, lastChange, now time.Time) string {
+	var lines []string
+	for _, line := range tail {
+		line = strings.TrimSpace(ansiRegexp.ReplaceAllString(line, ""))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 10 {
+		lines = lines[len(lines)-10:]
+	}
+	text := strings.Join(lines, "\n")
+	switch {
+	case stallInputRegexp.MatchString(text):
+		return stallWaitingInput
+	case stallErrorRegexp.MatchString(text):
+		return stallError
+	case now.Sub(lastChange) >= stallQuietPeriod:
+		return stallNoOutput
+	default:
+		return stallLongRunning
+	}
+}
+
+// stallPolicy はロールと分類に対するタイムアウトとアクションを決める
+func stallPolicy(role, kind string) (time.Duration, string) {
+	c := workerConfig.Stall
+	timeout, action := c.Timeout, c.Action
+	if a, ok := c.Actions[kind]; ok && a != "" {
+		action = a
+	}
+	rc, ok := c.Roles[role]
+	if !ok {
+		rc, ok = c.Roles[queueOf(role)]
+	}
+	if ok {
+		if rc.Timeout > 0 {
+			timeout = rc.Timeout
+		}
+		if rc.Action != "" {
+			action = rc.Action
+		}
+		if a, ok := rc.Actions[kind]; ok && a != "" {
+			action = a
+		}
+	}
+	return timeout, action
+}
+
+// watchStall はrunning/blockedのまま止まったロールを検出し、設定されたアクションを実行する
+func watchStall(role, paneID string) {
+	var lastCapture string
+	lastChange := time.Now()
+	for {
+		time.Sleep(stallCheckInterval)
+		out, err := exec.Command("tmux", "capture-pane", "-t", paneID, "-p", "-S", "-30").Output()
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		if string(out) != lastCapture {
+			lastCapture = string(out)
+			lastChange = now
+		}
+
+		mu.Lock()
+		status := paneStatus[role]
+		msg := currentMessage[role]
+		started := taskStartedAt[role]
+		// 状態が変わるか対処してからの経過時間で判定する
+		since := statusSince[role]
+		if handled := stallHandledAt[role]; handled.After(since) {
+			since = handled
+		}
+		if handled := stallHandledAt[role]; handled.After(started) {
+			started = handled
+		}
+		mu.Unlock()
+		if status != "running" && status != "blocked" {
+			continue
+		}
+
+		kind := classifyStall(strings.Split(lastCapture, "\n"), lastChange, now)
+		timeout, action := stallPolicy(role, kind)
+		exceeded := timeout > 0 && now.Sub(since) >= timeout
+		// タスクごとのタイムアウトは配信からの経過時間で判定する
+		if d, err := time.ParseDuration(msg.Timeout); err == nil && d > 0 && msg.ID != "" && now.Sub(started) >= d {
+			exceeded = true
+		}
+		if !exceeded {
+			continue
+		}
+
+		fmt.Printf("[STALL] %s: %s (%s経過, タスク %s) → %s\n", role, kind, formatElapsed(now.Sub(since).Seconds()), msg.ID, action)
+		util.Emit(util.Event{Type: "stall.detected", Role: role, MessageID: msg.ID, Data: map[string]interface{}{"kind": kind, "action": action}})
+		handleStall(role, paneID, kind, action, msg, lastCapture)
+		mu.Lock()
+		stallHandledAt[role] = time.Now()
+		mu.Unlock()
+	}
+}
+
+func handleStall(role, paneID, kind, action string, msg queueMessage, capture string) {
+	switch action {
+	case internal.StallNudge:
+		text := strings.ReplaceAll(workerConfig.Stall.NudgeMessage, "{task}", msg.ID)
+		exec.Command("tmux", "send-keys", "-t", paneID, text, "C-m").Run()
+
+	case internal.StallInterrupt:
+		exec.Command("tmux", "send-keys", "-t", paneID, "Escape").Run()
+		util.Emit(util.Event{Type: "task.cancelled", Role: role, MessageID: msg.ID, Data: map[string]interface{}{"reason": "stall"}})
+		mu.Lock()
+		// 中断したタスクは完了数に数えない
+		currentTask[role] = ""
+		setRoleState(role, "waiting")
+		mu.Unlock()
+
+	case internal.StallRestart:
+		exec.Command("tmux", "respawn-pane", "-k", "-t", paneID, "zsh").Run()
+		startTranscript(role, paneID)
+		exec.Command("tmux", "send-keys", "-t", paneID, getClaudeCommand(role), "C-m").Run()
+		util.Emit(util.Event{Type: "pane.restarted", Role: role, MessageID: msg.ID, Data: map[string]interface{}{"pane_id": paneID}})
+		mu.Lock()
+		restartCount[role]++
+		currentTask[role] = ""
+		currentCommand[role] = ""
+		delete(currentMessage, role)
+		setRoleState(role, "init")
+		mu.Unlock()
+		// 実行中だったタスクはやり直す
+		if msg.Text != "" {
+			retry := msg
+			retry.ID = ""
+			retry.CreatedAt = time.Time{}
+			enqueueMessage(retry)
+		}
+
+	case internal.StallEscalate:
+		if msg.From == "" || msg.From == "operator" || msg.From == "dashboard" {
+			fmt.Printf("[STALL] %s: タスク %s の送り元ロールが不明なためエスカレーションできません\n", role, msg.ID)
+			return
+		}
+		last := ""
+		lines := strings.Split(strings.TrimSpace(ansiRegexp.ReplaceAllString(capture, "")), "\n")
+		if len(lines) > 0 {
+			last = strings.TrimSpace(lines[len(lines)-1])
+		}
+		enqueueMessage(queueMessage{
+			Parent: msg.ID,
+			From:   role,
+			To:     queueOf(msg.From),
+			Text:   fmt.Sprintf("[stall] %sがタスク %s「%s」で停止しています(%s)。最後の出力: %s", role, msg.ID, msg.Text, kind, last),
+		})
+	}
+}
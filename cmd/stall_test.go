@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifyStall(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-10 * time.Second)
+	quiet := now.Add(-stallQuietPeriod)
+	tests := []struct {
+		name       string
+		tail       []string
+		lastChange time.Time
+		want       string
+	}{
+		{name: "確認の選択肢", tail: []string{"Do you want to proceed?", "❯ 1. Yes", "  2. No"}, lastChange: recent, want: stallWaitingInput},
+		{name: "y/nの入力待ち", tail: []string{"上書きしますか? (y/N)"}, lastChange: quiet, want: stallWaitingInput},
+		{name: "エラー表示", tail: []string{"API Error: rate limit exceeded"}, lastChange: quiet, want: stallError},
+		{name: "入力待ちはエラーより優先", tail: []string{"error: build failed", "Press Enter to continue"}, lastChange: recent, want: stallWaitingInput},
+		{name: "出力に変化がない", tail: []string{"考え中..."}, lastChange: quiet, want: stallNoOutput},
+		{name: "出力が続いている", tail: []string{"テストを実行しています"}, lastChange: recent, want: stallLongRunning},
+		{name: "エスケープシーケンスと空行を除く", tail: []string{"\x1b[31mFAILED\x1b[0m", "", "   "}, lastChange: recent, want: stallError},
+		{
+			name:       "末尾10行より前は見ない",
+			tail:       append([]string{"error: 古いエラー"}, "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"),
+			lastChange: recent,
+			want:       stallLongRunning,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStall(tt.tail, tt.lastChange, now); got != tt.want {
+				t.Errorf("classifyStall = %s, 期待は %s", got, tt.want)
+			}
+		})
+	}
+}
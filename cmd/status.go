@@ -0,0 +1,389 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// エージェントが報告する状態
+const (
+	agentBusy    = "busy"
+	agentIdle    = "idle"
+	agentBlocked = "blocked"
+	agentDone    = "done"
+)
+
+var agentStates = []string{agentBusy, agentIdle, agentBlocked, agentDone}
+
+// ペインに単独行で出力されたときだけ有効なステータスマーカー
+// 例: [CLAMPANY:done task=1a2b3c4d]
+// 従来の[READY]はidleとして扱う
+var (
+	statusMarkerRegexp = regexp.MustCompile(`^[^\[\w]*\[CLAMPANY:(busy|idle|blocked|done)(?: task=([^\]\s]+))?\]\s*$`)
+	readyMarkerRegexp  = regexp.MustCompile(`^[^\[\w]*\[READY\]\s*$`)
+)
+
+const (
+	statusDir      = "run/latest/status"
+	statusJSONPath = "run/latest/status.json"
+	statusTextPath = "run/latest/pane_status.txt"
+)
+
+// agentStatus はエージェントからの状態報告。run/latest/status/<role>.jsonに保存される
+type agentStatus struct {
+	Role      string    `json:"role"`
+	State     string    `json:"state"`
+	Task      string    `json:"task,omitempty"`
+	Source    string    `json:"source"`              // cli/marker/ready/hook
+	Message   string    `json:"message,omitempty"`   // blocked時の通知内容
+	Response  string    `json:"response,omitempty"`  // ターン終了時の最終応答
+	Cancelled bool      `json:"cancelled,omitempty"` // 操作者によるキャンセル
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func agentStatusPath(role string) string {
+	return filepath.Join(statusDir, role+".json")
+}
+
+func writeAgentStatus(st agentStatus) error {
+	if err := os.MkdirAll(statusDir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	// 書き込み途中のファイルをワーカーが読まないようにrenameで置き換える
+	tmp := agentStatusPath(st.Role) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, agentStatusPath(st.Role))
+}
+
+func readAgentStatus(role string) (agentStatus, error) {
+	var st agentStatus
+	b, err := os.ReadFile(agentStatusPath(role))
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(b, &st)
+	return st, err
+}
+
+// parseStatusMarker はペインの1行からステータスマーカーを読み取る。
+// [READY]は起動時にも出力されるため、Sourceをreadyとして明示的な報告と区別する
+func parseStatusMarker(role, line string) (agentStatus, bool) {
+	line = ansiRegexp.ReplaceAllString(line, "")
+	if m := statusMarkerRegexp.FindStringSubmatch(line); m != nil {
+		return agentStatus{Role: role, State: m[1], Task: m[2], Source: "marker"}, true
+	}
+	if readyMarkerRegexp.MatchString(line) {
+		return agentStatus{Role: role, State: agentIdle, Source: "ready"}, true
+	}
+	return agentStatus{}, false
+}
+
+// currentRole はペイン起動時に設定されるCLAMPANY_ROLEからロール名を得る
+func currentRole(flagRole string) string {
+	if flagRole != "" {
+		return flagRole
+	}
+	return os.Getenv("CLAMPANY_ROLE")
+}
+
+// roleStatus はstatus.jsonに出力するロールごとの状態
+type roleStatus struct {
+	Role           string    `json:"role"`
+	State          string    `json:"state"`
+	Task           string    `json:"task,omitempty"`
+	Command        string    `json:"command,omitempty"`
+	Since          time.Time `json:"since"`
+	SecondsInState float64   `json:"seconds_in_state"`
+	QueueDepth     int       `json:"queue_depth"`
+	Completed      int       `json:"completed"`
+	PaneID         string    `json:"pane_id"`
+	Health         string    `json:"health"` // ok/exited/dead/missing
+	Message        string    `json:"message,omitempty"`
+	// 5分・1時間・セッション全体のbusy/idle/blocked秒数
+	Utilization roleUtilization `json:"utilization"`
+}
+
+// workerStatus はワーカーが毎秒書き出すrun/latest/status.jsonの内容
+type workerStatus struct {
+	UpdatedAt      time.Time                 `json:"updated_at"`
+	Roles          []roleStatus              `json:"roles"`
+	Queues         map[string][]queueMessage `json:"queues"`
+	RecentMessages []deliveredMessage        `json:"recent_messages"`
+}
+
+// queueOf はロールにメッセージを供給するキュー名を返す
+func queueOf(role string) string {
+	if strings.HasPrefix(role, "engineer") {
+		return "engineer"
+	}
+	return role
+}
+
+// paneHealth はペインでエージェントのプロセスが動いているかを調べる
+func paneHealth(paneID string) string {
+	if paneID == "" {
+		return "missing"
+	}
+	out, err := exec.Command("tmux", "display-message", "-p", "-t", paneID, "#{pane_dead} #{pane_current_command}").Output()
+	if err != nil {
+		return "missing"
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) > 0 && fields[0] == "1" {
+		return "dead"
+	}
+	// エージェントが終了してシェルに戻っている
+	if len(fields) > 1 {
+		switch fields[1] {
+		case "zsh", "bash", "sh", "fish":
+			return "exited"
+		}
+	}
+	return "ok"
+}
+
+// snapshotStatus はワーカーの現在の状態を集める
+func snapshotStatus() workerStatus {
+	mu.Lock()
+	now := time.Now()
+	ws := workerStatus{UpdatedAt: now, Queues: map[string][]queueMessage{}}
+	for q, msgs := range pendingMessages {
+		ws.Queues[q] = append([]queueMessage(nil), msgs...)
+	}
+	ws.RecentMessages = append([]deliveredMessage(nil), recentMessages...)
+	for _, role := range workerRoles() {
+		ws.Roles = append(ws.Roles, roleStatus{
+			Role:           role,
+			State:          paneStatus[role],
+			Task:           currentTask[role],
+			Command:        currentCommand[role],
+			Since:          statusSince[role],
+			SecondsInState: now.Sub(statusSince[role]).Seconds(),
+			QueueDepth:     len(pendingMessages[queueOf(role)]),
+			Completed:      completedCount[role],
+			PaneID:         rolePanes[role],
+			Message:        blockedMessage[role],
+		})
+		if t := timelines[role]; t != nil {
+			ws.Roles[len(ws.Roles)-1].Utilization = t.summary(now)
+		}
+	}
+	mu.Unlock()
+	// tmuxの呼び出しはロック外で行う
+	for i := range ws.Roles {
+		if isExecRole(ws.Roles[i].Role) {
+			ws.Roles[i].Health = "ok"
+			continue
+		}
+		ws.Roles[i].Health = paneHealth(ws.Roles[i].PaneID)
+	}
+	return ws
+}
+
+// writeStatusFiles はstatus.jsonとpane_status.txtを書き出す
+func writeStatusFiles() {
+	ws := snapshotStatus()
+	os.MkdirAll("run/latest", 0755)
+	if b, err := json.MarshalIndent(ws, "", "  "); err == nil {
+		tmp := statusJSONPath + ".tmp"
+		if os.WriteFile(tmp, b, 0644) == nil {
+			os.Rename(tmp, statusJSONPath)
+		}
+	}
+	f, err := os.Create(statusTextPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	writeStatusText(f, ws.Roles)
+	writeSessionMetrics(ws.Roles)
+}
+
+func readWorkerStatus() (workerStatus, error) {
+	var ws workerStatus
+	b, err := os.ReadFile(statusJSONPath)
+	if err != nil {
+		return ws, err
+	}
+	err = json.Unmarshal(b, &ws)
+	return ws, err
+}
+
+// writeStatusText はロールの状態を1行ずつ表示用に整形する
+func writeStatusText(w io.Writer, roles []roleStatus) {
+	for _, rs := range roles {
+		// 稼働率: 直近5分のうちbusyだった時間の割合
+		u := rs.Utilization
+		rate := u.Last5m.Rate()
+		barLen := 10
+		barFill := int(float64(rate) / 100 * float64(barLen))
+		bar := strings.Repeat("█", barFill) + strings.Repeat("░", barLen-barFill)
+
+		// 状態アイコン
+		icon := "⚪"
+		switch rs.State {
+		case "running":
+			icon = "🟢"
+		case "waiting":
+			icon = "🟡"
+		case "blocked":
+			icon = "🔴"
+		case "init":
+			icon = "⚪"
+		}
+
+		// コマンド表示
+		cmdDisp := rs.Command
+		if cmdDisp == "" {
+			if rs.State == "init" {
+				cmdDisp = "(初期化中)"
+			} else {
+				cmdDisp = "(待機中)"
+			}
+		}
+
+		health := ""
+		if rs.Health != "" && rs.Health != "ok" {
+			health = " ⚠ " + rs.Health
+		}
+
+		fmt.Fprintf(w, "[%-9s]%s %-8s %6s | キュー: %2d | 完了: %3d | コマンド: %-20s | 稼働率(5m): %s %3d%% | 1h: %3d%% | 全体: %3d%% (busy %s / idle %s / blocked %s)%s\n",
+			rs.Role, icon, rs.State, formatElapsed(rs.SecondsInState), rs.QueueDepth, rs.Completed, cmdDisp, bar, rate,
+			u.Last1h.Rate(), u.Session.Rate(),
+			formatElapsed(u.Session.BusySeconds), formatElapsed(u.Session.IdleSeconds), formatElapsed(u.Session.BlockedSeconds), health)
+	}
+}
+
+// formatElapsed は経過秒数を1h02m/3m05s/12sの形式にする
+func formatElapsed(sec float64) string {
+	d := time.Duration(sec) * time.Second
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+var (
+	statusRole       string
+	statusTask       string
+	statusJSON       bool
+	statusWatch      bool
+	statusFilterRole string
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "ワーカーが書き出すrun/latest/status.jsonからロールの状態を表示する",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for {
+			ws, err := readWorkerStatus()
+			if err != nil {
+				fmt.Println("status.jsonが読み込めません（ワーカーが起動していない可能性があります）:", err)
+				os.Exit(1)
+			}
+			if statusFilterRole != "" {
+				var roles []roleStatus
+				for _, rs := range ws.Roles {
+					if rs.Role == statusFilterRole {
+						roles = append(roles, rs)
+					}
+				}
+				if len(roles) == 0 {
+					fmt.Printf("ロール %s が見つかりません\n", statusFilterRole)
+					os.Exit(1)
+				}
+				ws.Roles = roles
+				q := queueOf(statusFilterRole)
+				ws.Queues = map[string][]queueMessage{q: ws.Queues[q]}
+			}
+			if statusJSON {
+				// watch時は1行1スナップショットで出力する
+				enc := json.NewEncoder(os.Stdout)
+				if !statusWatch {
+					enc.SetIndent("", "  ")
+				}
+				enc.Encode(ws)
+			} else {
+				if statusWatch {
+					fmt.Print("\033[H\033[2J")
+				}
+				writeStatusText(os.Stdout, ws.Roles)
+				if time.Since(ws.UpdatedAt) > 5*time.Second {
+					fmt.Printf("(最終更新: %s 前。ワーカーが停止している可能性があります)\n", formatElapsed(time.Since(ws.UpdatedAt).Seconds()))
+				}
+			}
+			if !statusWatch {
+				return
+			}
+			time.Sleep(1 * time.Second)
+		}
+	},
+}
+
+var statusSetCmd = &cobra.Command{
+	Use:       "set <busy|idle|blocked|done>",
+	Short:     "エージェントが自ロールの状態をワーカーに報告する",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: agentStates,
+	Run: func(cmd *cobra.Command, args []string) {
+		state := args[0]
+		valid := false
+		for _, s := range agentStates {
+			if s == state {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			fmt.Printf("不正な状態です: %s (%s)\n", state, strings.Join(agentStates, "|"))
+			os.Exit(1)
+		}
+		role := currentRole(statusRole)
+		if role == "" {
+			fmt.Println("ロールが不明です。--roleを指定するかCLAMPANY_ROLEを設定してください")
+			os.Exit(1)
+		}
+		st := agentStatus{
+			Role:      role,
+			State:     state,
+			Task:      statusTask,
+			Source:    "cli",
+			UpdatedAt: time.Now(),
+		}
+		if err := writeAgentStatus(st); err != nil {
+			fmt.Println("ステータス書き込み失敗:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("[STATUS] %s → %s %s\n", role, state, statusTask)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.AddCommand(statusSetCmd)
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "JSONで出力する")
+	statusCmd.Flags().BoolVar(&statusWatch, "watch", false, "1秒ごとに更新して表示し続ける")
+	statusCmd.Flags().StringVar(&statusFilterRole, "role", "", "指定ロールだけ表示する")
+	statusSetCmd.Flags().StringVar(&statusRole, "role", "", "報告するロール名 (省略時はCLAMPANY_ROLE)")
+	statusSetCmd.Flags().StringVar(&statusTask, "task", "", "対象のタスクID")
+}
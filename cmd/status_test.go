@@ -0,0 +1,34 @@
+package cmd
+
+import "testing"
+
+func TestParseStatusMarker(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   agentStatus
+		wantOK bool
+	}{
+		{name: "タスク付きのdone", line: "[CLAMPANY:done task=1a2b3c4d]", want: agentStatus{Role: "dev", State: agentDone, Task: "1a2b3c4d", Source: "marker"}, wantOK: true},
+		{name: "タスクなしのbusy", line: "[CLAMPANY:busy]", want: agentStatus{Role: "dev", State: agentBusy, Source: "marker"}, wantOK: true},
+		{name: "行頭の記号と末尾の空白", line: "⏺ [CLAMPANY:blocked task=x]  ", want: agentStatus{Role: "dev", State: agentBlocked, Task: "x", Source: "marker"}, wantOK: true},
+		{name: "エスケープシーケンス", line: "\x1b[1m[CLAMPANY:idle task=x]\x1b[0m", want: agentStatus{Role: "dev", State: agentIdle, Task: "x", Source: "marker"}, wantOK: true},
+		{name: "[READY]はreadyとして区別する", line: "[READY]", want: agentStatus{Role: "dev", State: agentIdle, Source: "ready"}, wantOK: true},
+		{name: "文中のマーカーは無効", line: "完了したら [CLAMPANY:done task=x] と出力します", wantOK: false},
+		{name: "マーカーの後に文字", line: "[CLAMPANY:done task=x] です", wantOK: false},
+		{name: "不明な状態", line: "[CLAMPANY:finished task=x]", wantOK: false},
+		{name: "文中の[READY]は無効", line: "最後に[READY]と出力します", wantOK: false},
+		{name: "空行", line: "", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseStatusMarker("dev", tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, 期待は %v", ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseStatusMarker = %+v, 期待は %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"clampany/internal"
+	"clampany/internal/scheduler"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	taskAddRole      string
+	taskAddPrompt    string
+	taskAddCommand   string
+	taskAddDependsOn []string
+	taskAddWhen      string
+	taskAddRetries   int
+	taskAddTimeout   time.Duration
+	taskAddOnFailure string
+	taskAddRun       string
+	taskAddWait      time.Duration
+)
+
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "実行中のタスクDAGを操作する",
+}
+
+var taskAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "実行中のタスクDAGにタスクを追加する",
+	Long: `clampany runで実行中のDAGにタスクを追加します。依存先には実行済みのタスクも指定でき、
+終わっていない依存先があればその完了を待って実行されます。追加したタスクはrun.yamlにも記録されます。`,
+	Example: `  ./clampany task add lint --role build --command "golangci-lint run" --depends-on implement
+  ./clampany task add docs --role engineer1 --prompt "READMEを更新してください" --depends-on implement,lint`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if taskAddRole == "" {
+			fmt.Println("--roleを指定してください")
+			os.Exit(1)
+		}
+		var deps []string
+		for _, dep := range taskAddDependsOn {
+			if dep = strings.TrimSpace(dep); dep != "" {
+				deps = append(deps, dep)
+			}
+		}
+		t := internal.Task{
+			Name:      args[0],
+			Role:      taskAddRole,
+			Prompt:    taskAddPrompt,
+			Command:   taskAddCommand,
+			DependsOn: deps,
+			When:      taskAddWhen,
+			Retries:   taskAddRetries,
+			Timeout:   taskAddTimeout,
+			OnFailure: taskAddOnFailure,
+		}
+		runDir := taskAddRun
+		if !strings.Contains(runDir, string(filepath.Separator)) {
+			runDir = filepath.Join("run", runDir)
+		}
+		if err := scheduler.SubmitTask(runDir, t, taskAddWait); err != nil {
+			fmt.Printf("タスク %s を追加できません: %v\n", t.Name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("タスク %s を追加しました (%s)\n", t.Name, runDir)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(taskCmd)
+	taskCmd.AddCommand(taskAddCmd)
+	taskAddCmd.Flags().StringVar(&taskAddRole, "role", "", "タスクを実行するロール")
+	taskAddCmd.Flags().StringVar(&taskAddPrompt, "prompt", "", "AI・humanロールへの指示")
+	taskAddCmd.Flags().StringVar(&taskAddCommand, "command", "", "shellロールで実行するコマンド")
+	taskAddCmd.Flags().StringSliceVar(&taskAddDependsOn, "depends-on", nil, "依存するタスク (カンマ区切り)")
+	taskAddCmd.Flags().StringVar(&taskAddWhen, "when", "", "実行する条件 (tasks.yamlのwhenと同じ)")
+	taskAddCmd.Flags().IntVar(&taskAddRetries, "retries", 0, "失敗したときに再実行する回数")
+	taskAddCmd.Flags().DurationVar(&taskAddTimeout, "timeout", 0, "1回の実行の制限時間")
+	taskAddCmd.Flags().StringVar(&taskAddOnFailure, "on-failure", "", "失敗したときの扱い (stop|continue|skip_dependents)")
+	taskAddCmd.Flags().StringVar(&taskAddRun, "run", latestDir, "追加先のrun (run-idまたはディレクトリ)")
+	taskAddCmd.Flags().DurationVar(&taskAddWait, "wait", 10*time.Second, "受け付けを待つ時間")
+}
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"bufio"
+	"clampany/internal/util"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// traceNode はevents.jsonlから復元したメッセージとその処理結果
+type traceNode struct {
+	ID          string
+	Parent      string
+	From        string
+	To          string
+	Role        string // 実際に処理したロール
+	Text        string
+	EnqueuedAt  time.Time
+	DeliveredAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Outcome     string // pending/delivered/completed/cancelled
+	Children    []*traceNode
+}
+
+func (n *traceNode) duration() time.Duration {
+	if n.DeliveredAt.IsZero() || n.FinishedAt.IsZero() {
+		return 0
+	}
+	return n.FinishedAt.Sub(n.DeliveredAt)
+}
+
+// messageLog はセッションのメッセージをIDと親子関係で引けるようにしたもの
+type messageLog struct {
+	Nodes map[string]*traceNode
+	Roots []*traceNode // 親のない(または親が記録にない)メッセージ
+}
+
+func sessionEventsPath(session string) string {
+	if session == "" {
+		return eventsPath
+	}
+	return filepath.Join("run", session, "events.jsonl")
+}
+
+func readEvents(path string) ([]util.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []util.Event
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var ev util.Event
+			if json.Unmarshal(line, &ev) == nil {
+				events = append(events, ev)
+			}
+		}
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+	}
+}
+
+// loadMessageLog はevents.jsonlからメッセージの木を組み立てる
+func loadMessageLog(path string) (*messageLog, error) {
+	events, err := readEvents(path)
+	if err != nil {
+		return nil, err
+	}
+	ml := &messageLog{Nodes: map[string]*traceNode{}}
+	var order []*traceNode
+	for _, ev := range events {
+		if ev.MessageID == "" {
+			continue
+		}
+		n := ml.Nodes[ev.MessageID]
+		if n == nil {
+			if ev.Type != "message.enqueued" {
+				continue
+			}
+			n = &traceNode{ID: ev.MessageID, Outcome: "pending"}
+			ml.Nodes[ev.MessageID] = n
+			order = append(order, n)
+		}
+		switch ev.Type {
+		case "message.enqueued":
+			n.Parent, _ = ev.Data["parent"].(string)
+			n.From, _ = ev.Data["from"].(string)
+			n.To, _ = ev.Data["to"].(string)
+			n.Text, _ = ev.Data["text"].(string)
+			n.EnqueuedAt = ev.Time
+		case "message.delivered":
+			n.Role = ev.Role
+			n.DeliveredAt = ev.Time
+			n.Outcome = "delivered"
+		case "task.started":
+			if n.StartedAt.IsZero() {
+				n.StartedAt = ev.Time
+			}
+		case "task.completed":
+			n.FinishedAt = ev.Time
+			n.Outcome = "completed"
+		case "task.cancelled":
+			n.FinishedAt = ev.Time
+			n.Outcome = "cancelled"
+		}
+	}
+	for _, n := range order {
+		if p := ml.Nodes[n.Parent]; p != nil && n.Parent != n.ID {
+			p.Children = append(p.Children, n)
+		} else {
+			ml.Roots = append(ml.Roots, n)
+		}
+	}
+	for _, n := range order {
+		sort.SliceStable(n.Children, func(i, j int) bool {
+			return n.Children[i].EnqueuedAt.Before(n.Children[j].EnqueuedAt)
+		})
+	}
+	return ml, nil
+}
+
+func shorten(s string, n int) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n]) + "…"
+}
+
+func (n *traceNode) summary() string {
+	from := n.From
+	if from == "" {
+		from = "?"
+	}
+	to := n.To
+	if n.Role != "" && n.Role != n.To {
+		to = fmt.Sprintf("%s(%s)", n.To, n.Role)
+	}
+	info := n.Outcome
+	if d := n.duration(); d > 0 {
+		info += " " + formatElapsed(d.Seconds())
+	}
+	return fmt.Sprintf("[%s] %s → %s %s %q (%s)", n.ID, from, to, n.EnqueuedAt.Local().Format("15:04:05"), shorten(n.Text, 60), info)
+}
+
+func printTraceTree(w io.Writer, n *traceNode, prefix string, last, root bool) {
+	branch := ""
+	childPrefix := prefix
+	if !root {
+		if last {
+			branch = "└── "
+			childPrefix += "    "
+		} else {
+			branch = "├── "
+			childPrefix += "│   "
+		}
+	}
+	fmt.Fprintf(w, "%s%s%s\n", prefix, branch, n.summary())
+	for i, c := range n.Children {
+		printTraceTree(w, c, childPrefix, i == len(n.Children)-1, false)
+	}
+}
+
+func walkTrace(n *traceNode, fn func(*traceNode)) {
+	fn(n)
+	for _, c := range n.Children {
+		walkTrace(c, fn)
+	}
+}
+
+func graphLabel(n *traceNode) string {
+	label := fmt.Sprintf("%s → %s\n%s\n%s", n.From, n.To, shorten(n.Text, 40), n.Outcome)
+	if d := n.duration(); d > 0 {
+		label += " " + formatElapsed(d.Seconds())
+	}
+	return label
+}
+
+func writeTraceMermaid(w io.Writer, roots []*traceNode) {
+	fmt.Fprintln(w, "graph TD")
+	for _, r := range roots {
+		walkTrace(r, func(n *traceNode) {
+			label := strings.ReplaceAll(graphLabel(n), `"`, "#quot;")
+			fmt.Fprintf(w, "  m%s[\"%s\"]\n", n.ID, strings.ReplaceAll(label, "\n", "<br/>"))
+			for _, c := range n.Children {
+				fmt.Fprintf(w, "  m%s --> m%s\n", n.ID, c.ID)
+			}
+		})
+	}
+}
+
+func writeTraceDot(w io.Writer, roots []*traceNode) {
+	fmt.Fprintln(w, "digraph trace {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, r := range roots {
+		walkTrace(r, func(n *traceNode) {
+			fmt.Fprintf(w, "  %q [label=%q];\n", n.ID, graphLabel(n))
+			for _, c := range n.Children {
+				fmt.Fprintf(w, "  %q -> %q;\n", n.ID, c.ID)
+			}
+		})
+	}
+	fmt.Fprintln(w, "}")
+}
+
+var (
+	traceSession string
+	traceFormat  string
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace [message-id]",
+	Short: "メッセージから派生したメッセージの木を表示する (省略時はすべての起点メッセージ)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ml, err := loadMessageLog(sessionEventsPath(traceSession))
+		if err != nil {
+			fmt.Println("events.jsonlが読み込めません:", err)
+			os.Exit(1)
+		}
+		roots := ml.Roots
+		if len(args) == 1 {
+			n := ml.Nodes[args[0]]
+			if n == nil {
+				fmt.Printf("メッセージ %s が見つかりません\n", args[0])
+				os.Exit(1)
+			}
+			roots = []*traceNode{n}
+		}
+		switch traceFormat {
+		case "text":
+			for _, r := range roots {
+				printTraceTree(os.Stdout, r, "", true, true)
+			}
+		case "mermaid":
+			writeTraceMermaid(os.Stdout, roots)
+		case "dot":
+			writeTraceDot(os.Stdout, roots)
+		default:
+			fmt.Printf("不明な形式です: %s (text|mermaid|dot)\n", traceFormat)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+	traceCmd.Flags().StringVar(&traceSession, "session", "", "対象のセッション (省略時はrun/latest)")
+	traceCmd.Flags().StringVar(&traceFormat, "format", "text", "出力形式 (text|mermaid|dot)")
+}
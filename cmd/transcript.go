@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// トランスクリプトの各行の先頭に付けるタイムスタンプの形式
+const transcriptTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// CSI・OSC・その他のエスケープシーケンス
+var transcriptANSIRegexp = regexp.MustCompile(`\x1b\[[0-9;?<>=]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[@-Z\\-_=>]`)
+
+func transcriptPath(dir, role string) string {
+	return filepath.Join(dir, "transcripts", role+".log")
+}
+
+// startTranscript はペインの出力をclampany transcriptに流し込み、
+// run/<session>/transcripts/<role>.logに記録させる
+func startTranscript(role, paneID string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(transcriptPath(sessionDir, role))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// -o: すでにパイプがあれば何もしない
+	return exec.Command("tmux", "pipe-pane", "-o", "-t", paneID, fmt.Sprintf("%q transcript %q", exe, path)).Run()
+}
+
+// writeTranscript は端末出力からエスケープシーケンスを除去し、1行ごとにタイムスタンプを付けて書き出す
+func writeTranscript(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	var pending []byte
+	flush := func() error {
+		line := transcriptANSIRegexp.ReplaceAll(pending, nil)
+		line = bytes.Map(func(r rune) rune {
+			if r == '\t' || r >= 0x20 && r != 0x7f {
+				return r
+			}
+			return -1
+		}, line)
+		pending = pending[:0]
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "%s %s\n", time.Now().Format(transcriptTimeFormat), line)
+		return err
+	}
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if len(pending) > 0 {
+				flush()
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		// TUIは\rで行を書き換えるため\rも行の区切りとして扱う
+		if b == '\n' || b == '\r' {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		pending = append(pending, b)
+	}
+}
+
+// stripTranscriptTime はトランスクリプトの行の先頭のタイムスタンプを除く
+func stripTranscriptTime(line string) string {
+	if ts, rest, ok := strings.Cut(line, " "); ok {
+		if _, err := time.Parse(transcriptTimeFormat, ts); err == nil {
+			return rest
+		}
+	}
+	return line
+}
+
+// transcriptMarkers はロールのトランスクリプトのoffset以降からステータスマーカーを古い順に読み、
+// 次に読む位置とともに返す。書き込み途中の行は次回に読む。
+// ペインのスクロールバックと違い切り詰められないため、マーカーを取りこぼさない
+func transcriptMarkers(role string, offset int64) ([]agentStatus, int64) {
+	f, err := os.Open(transcriptPath(sessionDir, role))
+	if err != nil {
+		return nil, offset
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, offset
+	}
+	end := bytes.LastIndexByte(b, '\n')
+	if end < 0 {
+		return nil, offset
+	}
+	var markers []agentStatus
+	for _, line := range strings.Split(string(b[:end]), "\n") {
+		if st, ok := parseStatusMarker(role, stripTranscriptTime(line)); ok {
+			markers = append(markers, st)
+		}
+	}
+	return markers, offset + int64(end+1)
+}
+
+var transcriptCmd = &cobra.Command{
+	Use:    "transcript <path>",
+	Short:  "tmux pipe-paneから渡されたペイン出力をトランスクリプトに追記する",
+	Args:   cobra.ExactArgs(1),
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "トランスクリプトを開けません:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		writeTranscript(os.Stdin, f)
+	},
+}
+
+var (
+	logsFollow  bool
+	logsSince   time.Duration
+	logsSession string
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <role>",
+	Short: "ロールのトランスクリプト(run/<session>/transcripts/<role>.log)を表示する",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := latestDir
+		if logsSession != "" {
+			dir = filepath.Join("run", logsSession)
+		}
+		path := transcriptPath(dir, args[0])
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Println("トランスクリプトが見つかりません:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		var since time.Time
+		if logsSince > 0 {
+			since = time.Now().Add(-logsSince)
+		}
+		br := bufio.NewReader(f)
+		var partial string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				// 書き込み途中の行は次の読み込みで続きを待つ
+				partial += line
+				if !logsFollow {
+					if partial != "" {
+						printTranscriptLine(partial, since)
+					}
+					return
+				}
+				time.Sleep(500 * time.Millisecond)
+				continue
+			}
+			printTranscriptLine(partial+line, since)
+			partial = ""
+		}
+	},
+}
+
+func printTranscriptLine(line string, since time.Time) {
+	if !since.IsZero() {
+		ts, _, _ := strings.Cut(line, " ")
+		if t, err := time.Parse(transcriptTimeFormat, ts); err == nil && t.Before(since) {
+			return
+		}
+	}
+	fmt.Print(strings.TrimSuffix(line, "\n") + "\n")
+}
+
+func init() {
+	rootCmd.AddCommand(transcriptCmd)
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "追記を待って表示し続ける")
+	logsCmd.Flags().DurationVar(&logsSince, "since", 0, "指定時間以内の行だけ表示する (例: --since 10m)")
+	logsCmd.Flags().StringVar(&logsSession, "session", "", "対象のセッション (省略時はrun/latest)")
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscriptMarkers(t *testing.T) {
+	sessionDir = t.TempDir()
+	path := transcriptPath(sessionDir, "dev")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	appendLine := func(s string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+
+	appendLine("2026-01-01T12:00:00.000+09:00 [READY]\n2026-01-01T12:00:01.000+09:00 作業中\n")
+	markers, offset := transcriptMarkers("dev", 0)
+	if len(markers) != 1 || markers[0].Source != "ready" {
+		t.Fatalf("markers = %+v", markers)
+	}
+
+	// 書き込み途中の行は次回に読む
+	appendLine("2026-01-01T12:00:02.000+09:00 [CLAMPANY:done ta")
+	markers, next := transcriptMarkers("dev", offset)
+	if len(markers) != 0 || next != offset {
+		t.Fatalf("書き込み途中の行を読みました: %+v, offset %d → %d", markers, offset, next)
+	}
+	appendLine("sk=build]\n")
+	markers, next = transcriptMarkers("dev", next)
+	if len(markers) != 1 || markers[0].State != agentDone || markers[0].Task != "build" {
+		t.Fatalf("markers = %+v", markers)
+	}
+
+	// 読んだ位置以降に新しいマーカーがなければ何も返さない
+	if markers, _ := transcriptMarkers("dev", next); len(markers) != 0 {
+		t.Fatalf("同じマーカーを再び読みました: %+v", markers)
+	}
+}
+
+func TestTranscriptExcerpt(t *testing.T) {
+	sessionDir = t.TempDir()
+	path := transcriptPath(sessionDir, "dev")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	first := "2026-01-01T12:00:00.000+09:00 結果1\n"
+	next := "2026-01-01T12:00:05.000+09:00 [task:next] 次の依頼\n"
+	if err := os.WriteFile(path, []byte(first+next), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 完了時点の位置までで切り、次のタスクの配信を含めない
+	if got := transcriptExcerpt("dev", 0, int64(len(first))); got != "結果1" {
+		t.Errorf("transcriptExcerpt = %q", got)
+	}
+}
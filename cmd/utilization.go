@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ロール状態の集計区分
+const (
+	utilBusy    = "busy"
+	utilIdle    = "idle"
+	utilBlocked = "blocked"
+)
+
+// 直近の集計窓。これより古い区間は保持しない
+const (
+	utilShortWindow = 5 * time.Minute
+	utilLongWindow  = time.Hour
+)
+
+// utilization は集計窓内の状態ごとの秒数
+type utilization struct {
+	BusySeconds    float64 `json:"busy_seconds"`
+	IdleSeconds    float64 `json:"idle_seconds"`
+	BlockedSeconds float64 `json:"blocked_seconds"`
+}
+
+// Rate は集計窓内でbusyだった割合(0-100)
+func (u utilization) Rate() int {
+	total := u.BusySeconds + u.IdleSeconds + u.BlockedSeconds
+	if total <= 0 {
+		return 0
+	}
+	return int(u.BusySeconds / total * 100)
+}
+
+func (u *utilization) add(category string, d time.Duration) {
+	switch category {
+	case utilBusy:
+		u.BusySeconds += d.Seconds()
+	case utilBlocked:
+		u.BlockedSeconds += d.Seconds()
+	default:
+		u.IdleSeconds += d.Seconds()
+	}
+}
+
+// roleUtilization はロールの5分・1時間・セッション全体の集計
+type roleUtilization struct {
+	Last5m  utilization `json:"5m"`
+	Last1h  utilization `json:"1h"`
+	Session utilization `json:"session"`
+}
+
+type stateSpan struct {
+	category   string
+	start, end time.Time // endがゼロなら継続中
+}
+
+// roleTimeline はロールの状態遷移を記録し、時間窓ごとの滞在時間を集計する
+type roleTimeline struct {
+	spans   []stateSpan // 直近utilLongWindow分と継続中の区間
+	session utilization // 保持期間を過ぎて捨てた区間の合計
+}
+
+func utilCategory(status string) string {
+	switch status {
+	case "running":
+		return utilBusy
+	case "blocked":
+		return utilBlocked
+	default:
+		return utilIdle
+	}
+}
+
+// transition は状態の切り替わりを記録する
+func (t *roleTimeline) transition(category string, at time.Time) {
+	if n := len(t.spans); n > 0 {
+		if t.spans[n-1].category == category {
+			return
+		}
+		t.spans[n-1].end = at
+	}
+	t.spans = append(t.spans, stateSpan{category: category, start: at})
+	// 古い区間はセッション合計に畳み込む
+	cutoff := at.Add(-utilLongWindow)
+	for len(t.spans) > 1 && t.spans[0].end.Before(cutoff) {
+		t.session.add(t.spans[0].category, t.spans[0].end.Sub(t.spans[0].start))
+		t.spans = t.spans[1:]
+	}
+}
+
+// window はsince以降の状態ごとの滞在時間を返す
+func (t *roleTimeline) window(since, now time.Time) utilization {
+	var u utilization
+	for _, sp := range t.spans {
+		start, end := sp.start, sp.end
+		if end.IsZero() {
+			end = now
+		}
+		if start.Before(since) {
+			start = since
+		}
+		if end.After(start) {
+			u.add(sp.category, end.Sub(start))
+		}
+	}
+	return u
+}
+
+func (t *roleTimeline) summary(now time.Time) roleUtilization {
+	s := t.session
+	all := t.window(time.Time{}, now)
+	s.BusySeconds += all.BusySeconds
+	s.IdleSeconds += all.IdleSeconds
+	s.BlockedSeconds += all.BlockedSeconds
+	return roleUtilization{
+		Last5m:  t.window(now.Add(-utilShortWindow), now),
+		Last1h:  t.window(now.Add(-utilLongWindow), now),
+		Session: s,
+	}
+}
+
+// sessionMetrics はセッションディレクトリに保存するmetrics.jsonの内容
+type sessionMetrics struct {
+	UpdatedAt time.Time                  `json:"updated_at"`
+	Roles     map[string]roleUtilization `json:"roles"`
+}
+
+// writeSessionMetrics はロールごとの稼働時間をrun/<session>/metrics.jsonに保存する
+func writeSessionMetrics(roles []roleStatus) error {
+	m := sessionMetrics{UpdatedAt: time.Now(), Roles: map[string]roleUtilization{}}
+	for _, rs := range roles {
+		m.Roles[rs.Role] = rs.Utilization
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(sessionDir, "metrics.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
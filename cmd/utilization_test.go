@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoleTimeline(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	var tl roleTimeline
+	tl.transition(utilIdle, at(0))
+	tl.transition(utilBusy, at(10*time.Minute))
+	tl.transition(utilBusy, at(15*time.Minute)) // 同じ区分への遷移は区間を分けない
+	tl.transition(utilBlocked, at(20*time.Minute))
+	tl.transition(utilIdle, at(22*time.Minute))
+	now := at(25 * time.Minute)
+
+	tests := []struct {
+		name string
+		got  utilization
+		want utilization
+	}{
+		{name: "セッション全体", got: tl.summary(now).Session, want: utilization{BusySeconds: 600, IdleSeconds: 780, BlockedSeconds: 120}},
+		// 直近5分(20分〜25分)はblocked 2分とidle 3分
+		{name: "直近5分", got: tl.summary(now).Last5m, want: utilization{IdleSeconds: 180, BlockedSeconds: 120}},
+		{name: "窓の途中から始まる区間は窓内だけ数える", got: tl.window(at(12*time.Minute), now), want: utilization{BusySeconds: 480, IdleSeconds: 180, BlockedSeconds: 120}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("= %+v, 期待は %+v", tt.got, tt.want)
+			}
+		})
+	}
+	if got := tl.summary(now).Session.Rate(); got != 40 {
+		t.Errorf("Rate = %d, 期待は 40", got)
+	}
+}
+
+func TestRoleTimelineDropsOldSpans(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var tl roleTimeline
+	tl.transition(utilBusy, start)
+	tl.transition(utilIdle, start.Add(30*time.Minute))
+	// 1時間より前に終わった区間はセッション合計に畳み込み、集計結果は変わらない
+	now := start.Add(2 * time.Hour)
+	tl.transition(utilBusy, now)
+	if len(tl.spans) != 2 {
+		t.Fatalf("保持している区間 = %d, 期待は 2", len(tl.spans))
+	}
+	s := tl.summary(now)
+	if s.Session.BusySeconds != 1800 || s.Session.IdleSeconds != 5400 {
+		t.Errorf("Session = %+v", s.Session)
+	}
+	if s.Last1h.IdleSeconds != 3600 || s.Last1h.BusySeconds != 0 {
+		t.Errorf("Last1h = %+v", s.Last1h)
+	}
+}
+
+func TestUtilCategory(t *testing.T) {
+	for status, want := range map[string]string{"running": utilBusy, "blocked": utilBlocked, "waiting": utilIdle, "init": utilIdle} {
+		if got := utilCategory(status); got != want {
+			t.Errorf("utilCategory(%s) = %s, 期待は %s", status, got, want)
+		}
+	}
+}
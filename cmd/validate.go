@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"clampany/internal/loader"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <tasks.yaml> <roles.yaml>",
+	Short: "タスク・ロール定義を検査する",
+	Long: `不明なロール・依存先、重複したタスク名、依存関係の循環(経路付き)、
+commandのないshellタスク、promptのないAIタスクをファイル名と行番号付きで報告します。`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		tasks, roles, err := loader.LoadAndValidate(args[0], args[1])
+		var verrs loader.ValidationErrors
+		if errors.As(err, &verrs) {
+			for _, e := range verrs {
+				fmt.Println(e)
+			}
+			fmt.Printf("%d件のエラーがあります\n", len(verrs))
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Println("読み込み失敗:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("OK: %d件のタスク, %d件のロール\n", len(tasks), len(roles))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
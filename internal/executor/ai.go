@@ -2,42 +2,60 @@ package executor
 
 import (
 	"clampany/internal"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"strings"
+	"time"
 )
 
+// WaitFunc はロールからの完了の報告を待って応答を返す。
+// 報告はワーカー側の仕組み(ステータスファイルやマーカー)で受け取るため呼び出し側が用意する
+type WaitFunc func(ctx context.Context, t internal.Task, sent time.Time) (string, error)
+
 type AIExecutor struct {
 	Role       internal.Role
 	OutputDir  string
 	SaveOutput bool
 	PaneID     string // 割り当てられたtmuxペインID
+	// Wait がなければ送信だけして戻る。完了はワーカーがロールの状態として扱う
+	Wait WaitFunc
 }
 
-func (e *AIExecutor) Execute(prompt string) error {
-	fmt.Printf("[DEBUG] AIExecutor: %s へ送信: %s\n", e.PaneID, prompt)
-	err := exec.Command("tmux", "send-keys", "-t", e.PaneID, prompt, "C-m").Run()
+// Send はペインにテキストを入力する
+func (e *AIExecutor) Send(text string) error {
+	err := exec.Command("tmux", "send-keys", "-t", e.PaneID, text, "C-m").Run()
 	exec.Command("tmux", "send-keys", "-t", e.PaneID, "Enter").Run()
 
-	// --- 追加: AIの出力をinstructions.mdに追記 ---
-	// 1秒待ってからペインの最新10行を取得
-	exec.Command("sleep", "1").Run()
-	out, errCap := exec.Command("tmux", "capture-pane", "-t", e.PaneID, "-p", "-S", "-10").Output()
-	if errCap == nil {
-		lines := strings.Split(string(out), "\n")
-		output := strings.Join(lines, "\n")
-		if strings.TrimSpace(output) != "" {
-			roleSection := fmt.Sprintf("\n[%s]\n%s\n", e.PaneID, output)
-			f, err := os.OpenFile("instructions.md", os.O_APPEND|os.O_WRONLY, 0644)
-			if err == nil {
-				f.WriteString(roleSection)
-				f.Close()
-				fmt.Printf("[DEBUG] instructions.mdに追記: %s\n", roleSection)
-			}
+	// 出力はワーカーがtmux pipe-paneでトランスクリプトに記録する
+	return err
+}
+
+// Execute はタスクを[task:<name>]付きでペインに送り、Waitがあれば完了を待つ
+func (e *AIExecutor) Execute(ctx context.Context, req internal.ExecRequest) (internal.ExecResult, error) {
+	start := time.Now()
+	prompt := req.Task.Prompt
+	if req.Input != "" {
+		prompt += "\n\n# 依存タスクの出力\n\n" + req.Input
+	}
+	if req.ArtifactDir != "" {
+		if err := os.MkdirAll(req.ArtifactDir, 0755); err == nil {
+			prompt += "\n\n成果物のファイルを作った場合は " + req.ArtifactDir + " に置いてください。"
 		}
 	}
-	// --- ここまで追加 ---
-
-	return err
+	var res internal.ExecResult
+	if err := e.Send(fmt.Sprintf("[task:%s] %s", req.Task.Name, prompt)); err != nil {
+		return res, err
+	}
+	var err error
+	if e.Wait != nil {
+		res.Output, err = e.Wait(ctx, req.Task, start)
+		if req.Stream != nil && res.Output != "" {
+			io.WriteString(req.Stream, res.Output)
+		}
+	}
+	res.Artifacts = collectArtifacts(req.ArtifactDir)
+	res.Duration = time.Since(start)
+	return res, err
 }
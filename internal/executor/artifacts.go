@@ -0,0 +1,21 @@
+package executor
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// collectArtifacts はdir以下のファイルを返す。dirが空またはなければnil
+func collectArtifacts(dir string) []string {
+	if dir == "" {
+		return nil
+	}
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
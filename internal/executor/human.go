@@ -2,11 +2,30 @@ package executor
 
 import (
 	"clampany/internal"
+	"context"
+	"fmt"
+	"time"
 )
 
-type HumanExecutor struct{}
+type HumanExecutor struct {
+	// Wait がなければ指示を表示してすぐに完了とする
+	Wait WaitFunc
+}
 
-func (h *HumanExecutor) Execute(t internal.Task, in string) (string, error) {
-	// テスト用: 即return
-	return "done", nil
+// Execute は人間への指示をStreamに表示し、Waitがあれば完了の報告を待つ
+func (h *HumanExecutor) Execute(ctx context.Context, req internal.ExecRequest) (internal.ExecResult, error) {
+	start := time.Now()
+	if req.Stream != nil {
+		fmt.Fprintf(req.Stream, "[task:%s] %s\n", req.Task.Name, req.Task.Prompt)
+	}
+	res := internal.ExecResult{Output: "done"}
+	var err error
+	if h.Wait != nil {
+		res.Output, err = h.Wait(ctx, req.Task, start)
+	} else if err = ctx.Err(); err != nil {
+		res.Output = ""
+	}
+	res.Artifacts = collectArtifacts(req.ArtifactDir)
+	res.Duration = time.Since(start)
+	return res, err
 }
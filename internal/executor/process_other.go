@@ -0,0 +1,8 @@
+//go:build !unix
+
+package executor
+
+import "os/exec"
+
+// setProcessGroup はプロセスグループのない環境ではコマンドのプロセスだけを止める
+func setProcessGroup(cmd *exec.Cmd) {}
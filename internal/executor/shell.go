@@ -1,31 +1,58 @@
 package executor
 
 import (
+	"bytes"
 	"clampany/internal"
+	"context"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 )
 
+// shellWaitDelay は中断したコマンドの出力が閉じられるまで待つ時間
+const shellWaitDelay = 2 * time.Second
+
 type ShellExecutor struct{}
 
-func (e *ShellExecutor) Execute(t internal.Task, in string) (string, error) {
-	_, tmuxOk := os.LookupEnv("TMUX")
-	if tmuxOk {
-		args := []string{"split-window", "-v", "-c", os.Getenv("PWD")}
-		outputPath := os.Getenv("CLAMPANY_OUTPUT_PATH")
-		if outputPath == "" {
-			outputPath = "outputs/" + t.Name + ".md"
+// Execute はcommandをbashで実行する。依存タスクの出力は標準入力に渡し、
+// タスク名と成果物のディレクトリを環境変数CLAMPANY_TASK・CLAMPANY_ARTIFACT_DIRで渡す
+func (e *ShellExecutor) Execute(ctx context.Context, req internal.ExecRequest) (internal.ExecResult, error) {
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, "bash", "-c", req.Task.Command)
+	cmd.Stdin = strings.NewReader(req.Input)
+	cmd.Env = append(os.Environ(), "CLAMPANY_TASK="+req.Task.Name)
+	if req.ArtifactDir != "" {
+		if err := os.MkdirAll(req.ArtifactDir, 0755); err == nil {
+			cmd.Env = append(cmd.Env, "CLAMPANY_ARTIFACT_DIR="+req.ArtifactDir)
 		}
-		cmdStr := "mkdir -p outputs; " + t.Command + " | tee '" + outputPath + "' ; read -p 'Press Enter to close...'"
-		args = append(args, cmdStr)
-		tmuxCmd := exec.Command("tmux", args...)
-		_, err := tmuxCmd.CombinedOutput()
-		if err != nil {
-			return "[tmuxペインでshell実行エラー]", err
+	}
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if req.Stream != nil {
+		w = io.MultiWriter(&buf, req.Stream)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	// 中断したときはコマンドが起動した子プロセスもまとめて止める
+	setProcessGroup(cmd)
+	cmd.WaitDelay = shellWaitDelay
+
+	err := cmd.Run()
+	res := internal.ExecResult{
+		Output:    buf.String(),
+		Artifacts: collectArtifacts(req.ArtifactDir),
+		Duration:  time.Since(start),
+	}
+	if cmd.ProcessState != nil {
+		// シグナルで終了した場合は終了コードを持たない
+		if code := cmd.ProcessState.ExitCode(); code >= 0 {
+			res.ExitCode = &code
 		}
-		return "[tmuxペインでshell実行] (出力はoutputs/" + t.Name + ".md) に保存されました)", nil
 	}
-	cmd := exec.Command("bash", "-c", t.Command)
-	out, err := cmd.CombinedOutput()
-	return string(out), err
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return res, err
 }
@@ -0,0 +1,104 @@
+package loader
+
+import (
+	"clampany/internal"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig はワーカー設定を読み込む。ファイルがなければデフォルト値を返す
+func LoadConfig(path string) (internal.Config, error) {
+	cfg := internal.DefaultConfig()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, err
+	}
+	if err := validateStallConfig(cfg.Stall); err != nil {
+		return cfg, err
+	}
+	if err := validateClarificationConfig(cfg.Clarification); err != nil {
+		return cfg, err
+	}
+	if err := validateWorkerRoles(cfg.Roles); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// validateWorkerRoles はワーカーモードのshell/humanロールを検査する。AIロールはinstructions/で定義する
+func validateWorkerRoles(roles []internal.Role) error {
+	seen := map[string]bool{}
+	for i, r := range roles {
+		if r.Name == "" {
+			return fmt.Errorf("roles[%d]: nameがありません", i)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("roles: ロール名が重複しています: %s", r.Name)
+		}
+		seen[r.Name] = true
+		switch r.Type {
+		case internal.RoleShell, internal.RoleHuman:
+		default:
+			return fmt.Errorf("roles.%s: typeにはshellかhumanを指定してください: %q", r.Name, r.Type)
+		}
+	}
+	return nil
+}
+
+func validateClarificationConfig(c internal.ClarificationConfig) error {
+	for _, p := range c.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("clarification.patterns: 正規表現が不正です: %s: %w", p, err)
+		}
+	}
+	if c.MaxRounds < 0 {
+		return fmt.Errorf("clarification.max_rounds: 0以上を指定してください: %d", c.MaxRounds)
+	}
+	switch c.OnLimit {
+	case "", internal.ClarifyLimitFail, internal.ClarifyLimitAccept:
+	default:
+		return fmt.Errorf("clarification.on_limit: 不明な値です: %s (fail|accept)", c.OnLimit)
+	}
+	return nil
+}
+
+func validateStallConfig(c internal.StallConfig) error {
+	check := func(where, action string) error {
+		switch action {
+		case "", internal.StallNudge, internal.StallInterrupt, internal.StallRestart, internal.StallEscalate:
+			return nil
+		}
+		return fmt.Errorf("%s: 不明なアクションです: %s (nudge|interrupt|restart|escalate)", where, action)
+	}
+	if err := check("stall.action", c.Action); err != nil {
+		return err
+	}
+	for kind, action := range c.Actions {
+		if err := check("stall.actions."+kind, action); err != nil {
+			return err
+		}
+	}
+	for role, rc := range c.Roles {
+		if err := check("stall.roles."+role+".action", rc.Action); err != nil {
+			return err
+		}
+		for kind, action := range rc.Actions {
+			if err := check("stall.roles."+role+".actions."+kind, action); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
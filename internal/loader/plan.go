@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"clampany/internal"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LoadPlan は計画ファイルを読み込んで検査する。誤りがあればValidationErrorsを返す
+func LoadPlan(path string) (internal.Plan, error) {
+	var plan internal.Plan
+	pos, err := decodeWithPos(path, "tasks", &plan)
+	if err != nil {
+		return plan, err
+	}
+	if errs := validatePlan(plan, pos, path); len(errs) > 0 {
+		return plan, errs
+	}
+	return plan, nil
+}
+
+func validatePlan(plan internal.Plan, pos []itemPos, path string) ValidationErrors {
+	var errs ValidationErrors
+	posOf := func(i int) itemPos {
+		if i < len(pos) {
+			return pos[i]
+		}
+		return itemPos{}
+	}
+	if len(plan.Tasks) == 0 {
+		errs = append(errs, &ValidationError{File: path, Line: 1, Msg: "tasksがありません"})
+	}
+
+	// 循環の検査はタスク定義と同じ方法で行う
+	tasks := make([]internal.Task, len(plan.Tasks))
+	index := map[string]int{}
+	for i, pt := range plan.Tasks {
+		p := posOf(i)
+		add := func(field, msg string) {
+			errs = append(errs, &ValidationError{File: path, Line: p.line(field), Task: pt.ID, Msg: msg})
+		}
+		tasks[i] = internal.Task{Name: pt.ID, DependsOn: pt.DependsOn}
+		if pt.ID == "" {
+			add("id", "idのないタスクがあります")
+			continue
+		}
+		if first, ok := index[pt.ID]; ok {
+			add("id", fmt.Sprintf("idが重複しています (%d行目と同じ)", posOf(first).line("id")))
+		} else {
+			index[pt.ID] = i
+		}
+		if strings.TrimSpace(pt.Title) == "" {
+			add("id", "titleがありません")
+		}
+		if pt.Owner == "" {
+			add("id", "ownerがありません")
+		}
+		if len(pt.Acceptance) == 0 {
+			add("id", "acceptance(完了条件)がありません")
+		}
+	}
+	for i, pt := range plan.Tasks {
+		p := posOf(i)
+		for j, dep := range pt.DependsOn {
+			if _, ok := index[dep]; ok {
+				continue
+			}
+			line := p.line("depends_on")
+			if lines := p.Items["depends_on"]; j < len(lines) {
+				line = lines[j]
+			}
+			errs = append(errs, &ValidationError{File: path, Line: line, Task: pt.ID, Msg: fmt.Sprintf("不明な依存先です: %q", dep)})
+		}
+	}
+	for _, cycle := range findCycles(tasks, index) {
+		errs = append(errs, &ValidationError{
+			File: path,
+			Line: posOf(index[cycle[0]]).line("depends_on"),
+			Task: cycle[0],
+			Msg:  "依存関係が循環しています: " + strings.Join(cycle, " → "),
+		})
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return errs
+}
+
+// PlanTasks は計画をtasks.yamlのタスクに変換する。
+// promptにはタイトル・説明・完了条件・全体の目標を書き、依存タスクの出力は実行時に付く
+func PlanTasks(plan internal.Plan) []internal.Task {
+	tasks := make([]internal.Task, 0, len(plan.Tasks))
+	for _, pt := range plan.Tasks {
+		var b strings.Builder
+		b.WriteString(pt.Title + "\n")
+		if d := strings.TrimSpace(pt.Description); d != "" {
+			b.WriteString("\n" + d + "\n")
+		}
+		b.WriteString("\n# 完了条件\n\n")
+		for _, a := range pt.Acceptance {
+			b.WriteString("- " + a + "\n")
+		}
+		if g := strings.TrimSpace(plan.Goal); g != "" {
+			b.WriteString("\n# 全体の目標\n\n" + g + "\n")
+		}
+		prompt := b.String()
+		if strings.Contains(prompt, "{{") {
+			// テンプレートになったpromptには依存タスクの出力が自動では付かないため明示する
+			prompt = escapeTemplate(prompt)
+			if len(pt.DependsOn) > 0 {
+				prompt += "\n# 依存タスクの出力\n\n{{ input }}\n"
+			}
+		}
+		tasks = append(tasks, internal.Task{
+			Name:      pt.ID,
+			Role:      pt.Owner,
+			Prompt:    prompt,
+			DependsOn: pt.DependsOn,
+		})
+	}
+	return tasks
+}
+
+// escapeTemplate は計画の文章に含まれる{{をテンプレートとして展開されないようにする
+func escapeTemplate(s string) string {
+	return strings.ReplaceAll(s, "{{", `{{ "{{" }}`)
+}
@@ -0,0 +1,283 @@
+package loader
+
+import (
+	"clampany/internal"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError はタスク・ロール定義の誤りと、その定義位置
+type ValidationError struct {
+	File string
+	Line int
+	Task string
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Task != "" {
+		return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Task, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ValidationErrors は検査で見つかったすべての誤り。ファイル・行の順に並ぶ
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	lines := make([]string, len(es))
+	for i, e := range es {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// itemPos はYAMLのシーケンス要素1つ分の定義位置
+type itemPos struct {
+	Line   int
+	Fields map[string]int // キーごとの行
+	Items  map[string][]int
+}
+
+func (p itemPos) line(field string) int {
+	if l, ok := p.Fields[field]; ok {
+		return l
+	}
+	return p.Line
+}
+
+// decodeWithPos はpathのYAMLを読み込み、key直下のシーケンスの各要素の位置とともにoutへデコードする
+func decodeWithPos(path, key string, out interface{}) ([]itemPos, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	if err := doc.Content[0].Decode(out); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var positions []itemPos
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != key || root.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, item := range root.Content[i+1].Content {
+			pos := itemPos{Line: item.Line, Fields: map[string]int{}, Items: map[string][]int{}}
+			for j := 0; j+1 < len(item.Content); j += 2 {
+				k, v := item.Content[j], item.Content[j+1]
+				pos.Fields[k.Value] = k.Line
+				for _, e := range v.Content {
+					pos.Items[k.Value] = append(pos.Items[k.Value], e.Line)
+				}
+			}
+			positions = append(positions, pos)
+		}
+	}
+	return positions, nil
+}
+
+// LoadAndValidate はタスクとロールの定義を読み込んで検査する。
+// 誤りがあればValidationErrorsを返す。rolesPathが空ならロールの参照は検査しない
+func LoadAndValidate(tasksPath, rolesPath string) ([]internal.Task, []internal.Role, error) {
+	var tf TasksFile
+	taskPos, err := decodeWithPos(tasksPath, "tasks", &tf)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rf RolesFile
+	var rolePos []itemPos
+	if rolesPath != "" {
+		rolePos, err = decodeWithPos(rolesPath, "roles", &rf)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	errs := validate(tf.Tasks, taskPos, tasksPath, rf.Roles, rolePos, rolesPath)
+	if len(errs) > 0 {
+		return tf.Tasks, rf.Roles, errs
+	}
+	return tf.Tasks, rf.Roles, nil
+}
+
+func validate(tasks []internal.Task, taskPos []itemPos, tasksPath string, roles []internal.Role, rolePos []itemPos, rolesPath string) ValidationErrors {
+	var errs ValidationErrors
+	posOf := func(ps []itemPos, i int) itemPos {
+		if i < len(ps) {
+			return ps[i]
+		}
+		return itemPos{}
+	}
+
+	roleTypes := map[string]internal.RoleType{}
+	for i, r := range roles {
+		pos := posOf(rolePos, i)
+		add := func(field, msg string) {
+			errs = append(errs, &ValidationError{File: rolesPath, Line: pos.line(field), Msg: msg})
+		}
+		if r.Name == "" {
+			add("name", "名前のないロールがあります")
+			continue
+		}
+		if _, ok := roleTypes[r.Name]; ok {
+			add("name", fmt.Sprintf("ロール名が重複しています: %s", r.Name))
+			continue
+		}
+		switch r.Type {
+		case internal.RoleAI, internal.RoleShell, internal.RoleHuman:
+		default:
+			add("type", fmt.Sprintf("%s: 不明なロール種別です: %q (ai|shell|human)", r.Name, r.Type))
+		}
+		roleTypes[r.Name] = r.Type
+	}
+
+	taskIndex := map[string]int{}
+	for i, t := range tasks {
+		pos := posOf(taskPos, i)
+		add := func(field, msg string) {
+			errs = append(errs, &ValidationError{File: tasksPath, Line: pos.line(field), Task: t.Name, Msg: msg})
+		}
+		if t.Name == "" {
+			add("name", "名前のないタスクがあります")
+			continue
+		}
+		if first, ok := taskIndex[t.Name]; ok {
+			add("name", fmt.Sprintf("タスク名が重複しています (%d行目と同じ)", posOf(taskPos, first).line("name")))
+		} else {
+			taskIndex[t.Name] = i
+		}
+		typ, ok := roleTypes[t.Role]
+		if !ok && rolesPath != "" {
+			add("role", fmt.Sprintf("不明なロールです: %q", t.Role))
+		}
+		switch {
+		case typ == internal.RoleShell && strings.TrimSpace(t.Command) == "":
+			add("role", "shellロールのタスクにcommandがありません")
+		case typ == internal.RoleAI && strings.TrimSpace(t.Prompt) == "":
+			add("role", "AIロールのタスクにpromptがありません")
+		}
+		if len(t.Foreach) > 0 && len(t.Matrix) > 0 {
+			add("foreach", "foreachとmatrixは同時に指定できません")
+		}
+		for key, values := range t.Matrix {
+			if len(values) == 0 {
+				add("matrix", fmt.Sprintf("matrix.%sに値がありません", key))
+			}
+		}
+		switch t.OnFailure {
+		case "", internal.OnFailureStop, internal.OnFailureContinue, internal.OnFailureSkipDependents:
+		default:
+			add("on_failure", fmt.Sprintf("不明なon_failureです: %q (stop|continue|skip_dependents)", t.OnFailure))
+		}
+		if t.Retries < 0 {
+			add("retries", "retriesには0以上を指定してください")
+		}
+		if t.Backoff < 0 {
+			add("backoff", "backoffには0以上を指定してください")
+		}
+		if t.Timeout < 0 {
+			add("timeout", "timeoutには0以上を指定してください")
+		}
+		for j, cond := range t.RetryOn {
+			if cond == "timeout" {
+				continue
+			}
+			if _, err := strconv.Atoi(cond); err == nil {
+				continue
+			}
+			if _, err := regexp.Compile(cond); err != nil {
+				line := pos.line("retry_on")
+				if lines := pos.Items["retry_on"]; j < len(lines) {
+					line = lines[j]
+				}
+				errs = append(errs, &ValidationError{File: tasksPath, Line: line, Task: t.Name, Msg: fmt.Sprintf("retry_onの正規表現が不正です: %v", err)})
+			}
+		}
+	}
+	for i, t := range tasks {
+		pos := posOf(taskPos, i)
+		for j, dep := range t.DependsOn {
+			if _, ok := taskIndex[dep]; ok {
+				continue
+			}
+			line := pos.line("depends_on")
+			if lines := pos.Items["depends_on"]; j < len(lines) {
+				line = lines[j]
+			}
+			errs = append(errs, &ValidationError{File: tasksPath, Line: line, Task: t.Name, Msg: fmt.Sprintf("不明な依存先です: %q", dep)})
+		}
+	}
+
+	for _, cycle := range findCycles(tasks, taskIndex) {
+		i := taskIndex[cycle[0]]
+		errs = append(errs, &ValidationError{
+			File: tasksPath,
+			Line: posOf(taskPos, i).line("depends_on"),
+			Task: cycle[0],
+			Msg:  "依存関係が循環しています: " + strings.Join(cycle, " → "),
+		})
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File == rolesPath
+		}
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
+
+// findCycles は依存関係の循環を探し、循環ごとに経路(先頭のタスクで閉じる)を返す
+func findCycles(tasks []internal.Task, taskIndex map[string]int) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var stack []string
+	var cycles [][]string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range tasks[taskIndex[name]].DependsOn {
+			if _, ok := taskIndex[dep]; !ok {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				// スタック上のdepから現在のタスクまでが循環
+				for k := len(stack) - 1; k >= 0; k-- {
+					if stack[k] == dep {
+						cycle := append([]string(nil), stack[k:]...)
+						cycles = append(cycles, append(cycle, dep))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+	for _, t := range tasks {
+		if _, ok := taskIndex[t.Name]; ok && state[t.Name] == unvisited {
+			visit(t.Name)
+		}
+	}
+	return cycles
+}
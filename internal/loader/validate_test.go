@@ -0,0 +1,192 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRoles = `roles:
+  - name: build
+    type: shell
+  - name: dev
+    type: ai
+`
+
+func writeFiles(t *testing.T, tasks, roles string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	tasksPath := filepath.Join(dir, "tasks.yaml")
+	rolesPath := filepath.Join(dir, "roles.yaml")
+	if err := os.WriteFile(tasksPath, []byte(tasks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rolesPath, []byte(roles), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tasksPath, rolesPath
+}
+
+func TestLoadAndValidate(t *testing.T) {
+	type want struct {
+		line int
+		msg  string
+	}
+	tests := []struct {
+		name  string
+		tasks string
+		roles string
+		want  []want
+	}{
+		{
+			name: "正しい定義",
+			tasks: `tasks:
+  - name: test
+    role: build
+    command: go test ./...
+  - name: review
+    role: dev
+    prompt: レビューしてください
+    depends_on: [test]
+`,
+		},
+		{
+			name: "不明なロール",
+			tasks: `tasks:
+  - name: test
+    role: nobody
+    command: go test ./...
+`,
+			want: []want{{3, `不明なロールです: "nobody"`}},
+		},
+		{
+			name: "タスク名の重複は最初の定義の行を示す",
+			tasks: `tasks:
+  - name: test
+    role: build
+    command: a
+  - name: test
+    role: build
+    command: b
+`,
+			want: []want{{5, "タスク名が重複しています (2行目と同じ)"}},
+		},
+		{
+			name: "不明な依存先は要素の行を示す",
+			tasks: `tasks:
+  - name: test
+    role: build
+    command: a
+    depends_on:
+      - lint
+`,
+			want: []want{{6, `不明な依存先です: "lint"`}},
+		},
+		{
+			name: "循環は経路を示す",
+			tasks: `tasks:
+  - name: a
+    role: build
+    command: a
+    depends_on: [c]
+  - name: b
+    role: build
+    command: b
+    depends_on: [a]
+  - name: c
+    role: build
+    command: c
+    depends_on: [b]
+`,
+			want: []want{{5, "依存関係が循環しています: a → c → b → a"}},
+		},
+		{
+			name: "commandのないshellタスクとpromptのないAIタスク",
+			tasks: `tasks:
+  - name: test
+    role: build
+  - name: review
+    role: dev
+`,
+			want: []want{{3, "shellロールのタスクにcommandがありません"}, {5, "AIロールのタスクにpromptがありません"}},
+		},
+		{
+			name: "retry_onの不正な正規表現は要素の行を示す",
+			tasks: `tasks:
+  - name: test
+    role: build
+    command: a
+    retry_on:
+      - timeout
+      - "("
+`,
+			want: []want{{7, "retry_onの正規表現が不正です"}},
+		},
+		{
+			name: "負のbackoffとtimeoutはそれぞれの行を示す",
+			tasks: `tasks:
+  - name: test
+    role: build
+    command: a
+    backoff: -1s
+    timeout: -5s
+`,
+			want: []want{{5, "backoffには0以上"}, {6, "timeoutには0以上"}},
+		},
+		{
+			name: "ロールの誤りはroles.yamlの行を示す",
+			tasks: `tasks: []
+`,
+			roles: `roles:
+  - name: build
+    type: shell
+  - name: build
+    type: robot
+`,
+			want: []want{{4, "ロール名が重複しています: build"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := tt.roles
+			if roles == "" {
+				roles = testRoles
+			}
+			tasksPath, rolesPath := writeFiles(t, tt.tasks, roles)
+			_, _, err := LoadAndValidate(tasksPath, rolesPath)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("エラーを期待しませんでした: %v", err)
+				}
+				return
+			}
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("ValidationErrorsを期待しました: %v", err)
+			}
+			if len(errs) != len(tt.want) {
+				t.Fatalf("エラーが%d件 (期待は%d件):\n%v", len(errs), len(tt.want), errs)
+			}
+			for i, w := range tt.want {
+				if errs[i].Line != w.line || !strings.Contains(errs[i].Msg, w.msg) {
+					t.Errorf("errs[%d] = %d行目 %q, 期待は %d行目 %q", i, errs[i].Line, errs[i].Msg, w.line, w.msg)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAndValidateWithoutRoles(t *testing.T) {
+	tasksPath, _ := writeFiles(t, `tasks:
+  - name: test
+    role: build
+    depends_on: [lint]
+`, testRoles)
+	_, _, err := LoadAndValidate(tasksPath, "")
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !strings.Contains(errs[0].Msg, "不明な依存先です") {
+		t.Fatalf("ロールを検査せず依存先だけを報告するはずです: %v", err)
+	}
+}
@@ -1,5 +1,13 @@
 package internal
 
+import (
+	"context"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 type RoleType string
 
 const (
@@ -22,8 +30,185 @@ type Task struct {
 	Prompt    string   `yaml:"prompt"`
 	Command   string   `yaml:"command,omitempty"`
 	DependsOn []string `yaml:"depends_on"`
+
+	// Retries は失敗したときに再実行する回数
+	Retries int `yaml:"retries,omitempty"`
+	// Backoff は最初の再実行までの待ち時間。再実行のたびに2倍になる
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// Timeout を超えた試行は失敗として扱う。0なら無制限
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// RetryOn は再実行する失敗の条件。数値は終了コード、timeoutはタイムアウト、
+	// それ以外は出力またはエラーに対する正規表現。空ならすべての失敗で再実行する
+	RetryOn []string `yaml:"retry_on,omitempty"`
+	// OnFailure は再実行しても失敗したときの扱い (stop|continue|skip_dependents)。
+	// 省略時はskip_dependents
+	OnFailure string `yaml:"on_failure,omitempty"`
+	// NoCache のタスクは出力をキャッシュせず、毎回実行する
+	NoCache bool `yaml:"no_cache,omitempty"`
+
+	// When はテンプレートの式。依存タスクの終了後に評価し、falseならタスクをスキップする
+	When string `yaml:"when,omitempty"`
+	// Foreach の要素ごとにタスクを展開する。*?[を含む要素はファイルのglobとして展開する
+	Foreach StringList `yaml:"foreach,omitempty"`
+	// Matrix の値の組み合わせごとにタスクを展開する
+	Matrix map[string][]string `yaml:"matrix,omitempty"`
+
+	// 以下はforeach/matrixで展開したタスクに設定される
+	Group        string            `yaml:"-"` // 展開元のタスク名
+	Item         string            `yaml:"-"` // foreachの要素
+	MatrixValues map[string]string `yaml:"-"` // matrixの組み合わせ
 }
 
+// StringList は文字列1つ、または文字列のリストとして書ける値
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = StringList{n.Value}
+		return nil
+	}
+	var list []string
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// 失敗したタスクの扱い
+const (
+	OnFailureStop           = "stop"            // 未実行のタスクをすべてキャンセルする
+	OnFailureContinue       = "continue"        // 依存するタスクもそのまま実行する
+	OnFailureSkipDependents = "skip_dependents" // 依存するタスクをスキップする
+)
+
+// タスクの状態
+const (
+	TaskPending   = "pending"
+	TaskRunning   = "running"
+	TaskSucceeded = "succeeded"
+	TaskFailed    = "failed"
+	TaskSkipped   = "skipped"
+	TaskCancelled = "cancelled"
+)
+
+// Plan はPMがCEOの目標をタスクに分解して_clampany/plans/に書く計画
+type Plan struct {
+	Goal  string     `yaml:"goal"`
+	Tasks []PlanTask `yaml:"tasks"`
+}
+
+// PlanTask は計画の1タスク。plan importでtasks.yamlのタスクになる
+type PlanTask struct {
+	ID          string   `yaml:"id"`
+	Title       string   `yaml:"title"`
+	Owner       string   `yaml:"owner"` // 担当するロール
+	DependsOn   []string `yaml:"depends_on,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Acceptance  []string `yaml:"acceptance"` // 完了条件
+}
+
+// Executor はロールにタスクを実行させる。ctxがキャンセルされたら実行を中断して戻る
 type Executor interface {
-	Execute(t Task, in string) (out string, err error)
+	Execute(ctx context.Context, req ExecRequest) (ExecResult, error)
+}
+
+// ExecRequest は実行器に渡すタスクと実行の条件
+type ExecRequest struct {
+	Task  Task
+	Input string // 依存タスクの出力
+	// Stream があれば実行中の出力を逐次書き込む
+	Stream io.Writer
+	// ArtifactDir はタスクが成果物を置くディレクトリ。空なら成果物を集めない
+	ArtifactDir string
+}
+
+// ExecResult は実行の結果
+type ExecResult struct {
+	Output    string
+	ExitCode  *int     // 終了コードを持つ実行器だけ設定する
+	Artifacts []string // ArtifactDirに置かれたファイル
+	Duration  time.Duration
+}
+
+// Config は_clampany/config.yamlで指定するワーカーモードとタスクDAGの実行の設定
+type Config struct {
+	Status        StatusConfig        `yaml:"status"`
+	Stall         StallConfig         `yaml:"stall"`
+	Clarification ClarificationConfig `yaml:"clarification"`
+	// Roles はワーカーモードでAIロールと並べて使うshell/humanロール
+	Roles []Role `yaml:"roles"`
+}
+
+// StatusConfig はロール状態の判定方法の設定
+type StatusConfig struct {
+	// ScrapeFallback はステータスプロトコルの報告がないロールに限り、
+	// ペイン出力のScrapePattern検出でrunning/waitingを判定する
+	ScrapeFallback bool   `yaml:"scrape_fallback"`
+	ScrapePattern  string `yaml:"scrape_pattern"`
+}
+
+// 停止したロールへのアクション
+const (
+	StallNudge     = "nudge"     // 進捗確認のメッセージを送る
+	StallInterrupt = "interrupt" // 実行中のタスクを中断する
+	StallRestart   = "restart"   // エージェントを再起動し、タスクをキューに戻す
+	StallEscalate  = "escalate"  // タスクの送り元ロールに報告する
+)
+
+// StallConfig はrunning/blockedのまま止まったロールの検出と対処の設定
+type StallConfig struct {
+	// Timeout を超えて同じ状態が続いたら停止とみなす。0なら検出しない
+	Timeout time.Duration `yaml:"timeout"`
+	Action  string        `yaml:"action"`
+	// Actions は停止の分類(waiting_input/no_output/error/long_running)ごとのアクション
+	Actions      map[string]string          `yaml:"actions"`
+	NudgeMessage string                     `yaml:"nudge_message"`
+	Roles        map[string]StallRoleConfig `yaml:"roles"`
+}
+
+// StallRoleConfig はロールごとの上書き設定。engineerはengineer1などにも適用される
+type StallRoleConfig struct {
+	Timeout time.Duration     `yaml:"timeout"`
+	Action  string            `yaml:"action"`
+	Actions map[string]string `yaml:"actions"`
+}
+
+// ClarifyMarker はエージェントが確認を求めるときに出力する行の先頭。続く文字列を質問とする
+const ClarifyMarker = "[CLAMPANY:clarify]"
+
+// 確認の回数が上限に達したときの扱い
+const (
+	ClarifyLimitFail   = "fail"   // タスクを失敗にする
+	ClarifyLimitAccept = "accept" // 最後の出力をタスクの結果とする
+)
+
+// ClarificationConfig はタスクDAGの実行中にタスクが確認を求めたときの設定
+type ClarificationConfig struct {
+	// Patterns は出力が確認を求めているとみなす正規表現。ClarifyMarkerは常に検出する
+	Patterns []string `yaml:"patterns"`
+	// Roles は確認を求めたロールごとの回答するロール。engineerはengineer1などにも適用される
+	Roles map[string]string `yaml:"roles"`
+	// MaxRounds はタスクごとに確認できる回数
+	MaxRounds int `yaml:"max_rounds"`
+	// OnLimit は回数が上限に達したとき、または回答するロールがないときの扱い (fail|accept)
+	OnLimit string `yaml:"on_limit"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Status: StatusConfig{
+			ScrapeFallback: true,
+			ScrapePattern:  "tokens",
+		},
+		Stall: StallConfig{
+			Timeout:      20 * time.Minute,
+			Action:       StallNudge,
+			NudgeMessage: "長時間応答がありません。作業中なら続けてください。完了している場合は ./clampany status set done --task {task} を実行してください。",
+		},
+		Clarification: ClarificationConfig{
+			MaxRounds: 2,
+			OnLimit:   ClarifyLimitFail,
+		},
+	}
 }
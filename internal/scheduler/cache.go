@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// fingerprintVersion は指紋の計算方法を変えたときに古いキャッシュを使わないためのもの
+const fingerprintVersion = "v1"
+
+// Cache はタスクの指紋ごとに成功した出力を保存する
+type Cache struct {
+	Dir string
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint は展開後のタスクと依存タスクの出力から指紋を計算する
+func Fingerprint(t internal.Task, in string, deps map[string]DepResult) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00", fingerprintVersion, t.Role, t.Prompt, t.Command, hashString(in))
+	names := append([]string(nil), t.DependsOn...)
+	sort.Strings(names)
+	for _, name := range names {
+		d := deps[name]
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", name, d.Status, hashString(d.Output))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) path(fp string) string {
+	return filepath.Join(c.Dir, fp+".md")
+}
+
+// Load は指紋に対応する出力を返す
+func (c *Cache) Load(fp string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	b, err := os.ReadFile(c.path(fp))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// Store は成功したタスクの出力を保存する
+func (c *Cache) Store(fp, out string) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	tmp := c.path(fp) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(out), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path(fp))
+}
+
+// ResolveTaskNames は名前(foreach/matrixの展開元の名前も可)に当てはまるタスク名を返す
+func ResolveTaskNames(tasks []internal.Task, name string) []string {
+	var names []string
+	for _, t := range tasks {
+		if t.Name == name || t.Group == name {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// Descendants はnamesとそれに(間接的に)依存するタスクの集合を返す
+func Descendants(tasks []internal.Task, names []string) map[string]bool {
+	children := map[string][]string{}
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			children[dep] = append(children[dep], t.Name)
+		}
+	}
+	set := map[string]bool{}
+	var visit func(string)
+	visit = func(name string) {
+		if set[name] {
+			return
+		}
+		set[name] = true
+		for _, c := range children[name] {
+			visit(c)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return set
+}
+
+// Ancestors はnamesが(間接的に)依存するタスクの集合を返す。names自身は含まない
+func Ancestors(tasks []internal.Task, names []string) map[string]bool {
+	byName := map[string]internal.Task{}
+	for _, t := range tasks {
+		byName[t.Name] = t
+	}
+	set := map[string]bool{}
+	var visit func(string)
+	visit = func(name string) {
+		for _, dep := range byName[name].DependsOn {
+			if !set[dep] {
+				set[dep] = true
+				visit(dep)
+			}
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return set
+}
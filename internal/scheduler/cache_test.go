@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := internal.Task{Name: "review", Role: "dev", Prompt: "レビューしてください", DependsOn: []string{"lint", "test"}}
+	deps := map[string]DepResult{
+		"lint": {Output: "ok", Status: internal.TaskSucceeded},
+		"test": {Output: "PASS", Status: internal.TaskSucceeded},
+	}
+	fp := Fingerprint(base, "in", deps)
+
+	tests := []struct {
+		name   string
+		task   func(internal.Task) internal.Task
+		in     string
+		deps   func() map[string]DepResult
+		change bool
+	}{
+		{name: "同じ入力", change: false},
+		{
+			name:   "依存先の順序は影響しない",
+			task:   func(t internal.Task) internal.Task { t.DependsOn = []string{"test", "lint"}; return t },
+			change: false,
+		},
+		{
+			name:   "タスク名は影響しない",
+			task:   func(t internal.Task) internal.Task { t.Name = "review2"; return t },
+			change: false,
+		},
+		{
+			name:   "プロンプト",
+			task:   func(t internal.Task) internal.Task { t.Prompt += "。"; return t },
+			change: true,
+		},
+		{
+			name:   "コマンド",
+			task:   func(t internal.Task) internal.Task { t.Command = "true"; return t },
+			change: true,
+		},
+		{
+			name:   "ロール",
+			task:   func(t internal.Task) internal.Task { t.Role = "dev2"; return t },
+			change: true,
+		},
+		{name: "入力", in: "in2", change: true},
+		{
+			name: "依存タスクの出力",
+			deps: func() map[string]DepResult {
+				return map[string]DepResult{"lint": deps["lint"], "test": {Output: "FAIL", Status: internal.TaskSucceeded}}
+			},
+			change: true,
+		},
+		{
+			name: "依存タスクの状態",
+			deps: func() map[string]DepResult {
+				return map[string]DepResult{"lint": deps["lint"], "test": {Output: "PASS", Status: internal.TaskFailed}}
+			},
+			change: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, in, d := base, "in", deps
+			if tt.task != nil {
+				task = tt.task(task)
+			}
+			if tt.in != "" {
+				in = tt.in
+			}
+			if tt.deps != nil {
+				d = tt.deps()
+			}
+			got := Fingerprint(task, in, d)
+			if (got != fp) != tt.change {
+				t.Errorf("指紋が変わった = %v, 期待は %v", got != fp, tt.change)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"clampany/internal/util"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ClarificationRound は1回分の確認の記録
+type ClarificationRound struct {
+	Round    int    `yaml:"round"`
+	Role     string `yaml:"role"` // 回答したロール
+	Question string `yaml:"question"`
+	Answer   string `yaml:"answer,omitempty"`
+	Error    string `yaml:"error,omitempty"`
+}
+
+// clarifier はタスクの出力から確認の依頼を検出する
+type clarifier struct {
+	cfg      internal.ClarificationConfig
+	patterns []*regexp.Regexp
+}
+
+func newClarifier(cfg internal.ClarificationConfig) (*clarifier, error) {
+	c := &clarifier{cfg: cfg}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("clarification.patterns: 正規表現が不正です: %s: %w", p, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c, nil
+}
+
+// question は出力が確認を求めていれば質問を返す。
+// マーカーがあればそれ以降、パターンに当てはまった場合は出力全体を質問とする
+func (c *clarifier) question(out string) (string, bool) {
+	if i := strings.Index(out, internal.ClarifyMarker); i >= 0 {
+		q := strings.TrimSpace(out[i+len(internal.ClarifyMarker):])
+		if q == "" {
+			q = strings.TrimSpace(out[:i])
+		}
+		return q, true
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(out) {
+			return strings.TrimSpace(out), true
+		}
+	}
+	return "", false
+}
+
+// ClarificationTarget はroleの確認に回答するロールを返す。
+// engineer1のように番号の付いたロールには番号を除いた名前の設定も使う
+func ClarificationTarget(cfg internal.ClarificationConfig, role string) (string, bool) {
+	target, ok := cfg.Roles[role]
+	if !ok {
+		target, ok = cfg.Roles[strings.TrimRight(role, "0123456789")]
+	}
+	return target, ok && target != ""
+}
+
+// clarifyTask は回答するロールに送るタスクを作る
+func clarifyTask(t internal.Task, target, question string, round int) internal.Task {
+	return internal.Task{
+		Name: fmt.Sprintf("%s_clarify%d", t.Name, round),
+		Role: target,
+		Prompt: fmt.Sprintf("タスク %s (%s) から確認の依頼です。質問に回答してください。\n\n# 質問\n\n%s\n\n# タスクの指示\n\n%s",
+			t.Name, t.Role, question, t.Prompt),
+	}
+}
+
+// withAnswers はこれまでの回答をpromptに付けたタスクを返す
+func withAnswers(t internal.Task, rounds []ClarificationRound) internal.Task {
+	var b strings.Builder
+	b.WriteString(t.Prompt)
+	b.WriteString("\n\n# 確認への回答\n")
+	for _, r := range rounds {
+		fmt.Fprintf(&b, "\n## %d回目 (%s)\n\n質問:\n%s\n\n回答:\n%s\n", r.Round, r.Role, r.Question, strings.TrimSpace(r.Answer))
+	}
+	t.Prompt = b.String()
+	return t
+}
+
+// taskRunner は実行器でタスクを実行する関数
+type taskRunner func(t internal.Task, in string) (internal.ExecResult, []Attempt, error)
+
+// clarify は出力が確認を求めている間、回答するロールに質問し、回答を付けてタスクを再実行する。
+// 回数が上限に達したときはOnLimitに従う
+func (c *clarifier) clarify(t internal.Task, in string, res internal.ExecResult, run taskRunner) (internal.ExecResult, []ClarificationRound, []Attempt, error) {
+	var rounds []ClarificationRound
+	var attempts []Attempt
+	for {
+		q, ok := c.question(res.Output)
+		if !ok {
+			return res, rounds, attempts, nil
+		}
+		target, ok := ClarificationTarget(c.cfg, t.Role)
+		var reason string
+		switch {
+		case !ok:
+			reason = fmt.Sprintf("確認を求めましたが、%sに回答するロールがありません (clarification.roles)", t.Role)
+		case len(rounds) >= c.cfg.MaxRounds:
+			reason = fmt.Sprintf("確認の回数が上限(%d回)に達しました", c.cfg.MaxRounds)
+		}
+		if reason != "" {
+			if c.cfg.OnLimit == internal.ClarifyLimitAccept {
+				util.Info("%s: %s。最後の出力を結果とします", t.Name, reason)
+				return res, rounds, attempts, nil
+			}
+			return res, rounds, attempts, errors.New(reason)
+		}
+
+		round := ClarificationRound{Round: len(rounds) + 1, Role: target, Question: q}
+		util.Info("[CLARIFY] %s → %s (%d/%d回目)", t.Name, target, round.Round, c.cfg.MaxRounds)
+		answer, _, err := run(clarifyTask(t, target, q, round.Round), "")
+		if err != nil {
+			round.Error = err.Error()
+			return res, append(rounds, round), attempts, fmt.Errorf("%sの回答に失敗: %w", target, err)
+		}
+		round.Answer = answer.Output
+		rounds = append(rounds, round)
+
+		var more []Attempt
+		res, more, err = run(withAnswers(t, rounds), in)
+		attempts = append(attempts, more...)
+		if err != nil {
+			return res, rounds, attempts, err
+		}
+	}
+}
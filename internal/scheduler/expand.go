@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var unsafeNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// foreachItems はforeachの要素を展開する。*?[を含む要素はglobとしてファイルに展開する
+func foreachItems(list internal.StringList) ([]string, error) {
+	var items []string
+	for _, entry := range list {
+		if !strings.ContainsAny(entry, "*?[") {
+			items = append(items, entry)
+			continue
+		}
+		matches, err := filepath.Glob(entry)
+		if err != nil {
+			return nil, fmt.Errorf("foreachのパターンが不正です: %s: %w", entry, err)
+		}
+		sort.Strings(matches)
+		items = append(items, matches...)
+	}
+	return items, nil
+}
+
+// matrixCombinations はmatrixの値のすべての組み合わせをキーの名前順に返す
+func matrixCombinations(matrix map[string][]string) []map[string]string {
+	keys := make([]string, 0, len(matrix))
+	for k := range matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	combos := []map[string]string{{}}
+	for _, k := range keys {
+		var next []map[string]string
+		for _, c := range combos {
+			for _, v := range matrix[k] {
+				m := map[string]string{k: v}
+				for ck, cv := range c {
+					m[ck] = cv
+				}
+				next = append(next, m)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// instanceSuffix は展開したタスクの名前に付ける、要素から作った識別子
+func instanceSuffix(s string) string {
+	s = strings.TrimSuffix(filepath.Base(s), filepath.Ext(s))
+	return strings.Trim(unsafeNameRegexp.ReplaceAllString(s, "_"), "_")
+}
+
+// ExpandTasks はforeach/matrixを持つタスクを要素ごとのタスクに展開する。
+// 展開したタスクは<name>-<要素>という名前になり、元の名前に依存していたタスクは
+// 展開したすべてのタスクに依存する
+func ExpandTasks(tasks []internal.Task) ([]internal.Task, error) {
+	var out []internal.Task
+	groups := map[string][]string{}
+	for _, t := range tasks {
+		if len(t.Foreach) == 0 && len(t.Matrix) == 0 {
+			out = append(out, t)
+			continue
+		}
+		var instances []internal.Task
+		if len(t.Foreach) > 0 {
+			items, err := foreachItems(t.Foreach)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", t.Name, err)
+			}
+			for _, item := range items {
+				inst := t
+				inst.Item = item
+				inst.Name = t.Name + "-" + instanceSuffix(item)
+				instances = append(instances, inst)
+			}
+		} else {
+			for _, combo := range matrixCombinations(t.Matrix) {
+				var parts []string
+				for _, k := range sortedKeys(combo) {
+					parts = append(parts, instanceSuffix(combo[k]))
+				}
+				inst := t
+				inst.MatrixValues = combo
+				inst.Name = t.Name + "-" + strings.Join(parts, "-")
+				instances = append(instances, inst)
+			}
+		}
+		if len(instances) == 0 {
+			return nil, fmt.Errorf("%s: foreach/matrixの展開結果が空です", t.Name)
+		}
+		// 要素から作った名前が重複した場合は番号で区別する
+		seen := map[string]bool{}
+		for i := range instances {
+			inst := &instances[i]
+			if seen[inst.Name] || strings.HasSuffix(inst.Name, "-") {
+				inst.Name = fmt.Sprintf("%s-%d", t.Name, i+1)
+			}
+			seen[inst.Name] = true
+			inst.Group = t.Name
+			inst.Foreach = nil
+			inst.Matrix = nil
+			groups[t.Name] = append(groups[t.Name], inst.Name)
+		}
+		out = append(out, instances...)
+	}
+
+	for i := range out {
+		var deps []string
+		for _, dep := range out[i].DependsOn {
+			if members, ok := groups[dep]; ok {
+				deps = append(deps, members...)
+			} else {
+				deps = append(deps, dep)
+			}
+		}
+		out[i].DependsOn = deps
+	}
+	names := map[string]bool{}
+	for _, t := range out {
+		if names[t.Name] {
+			return nil, fmt.Errorf("展開したタスク名が他のタスクと重複しています: %s", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return out, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
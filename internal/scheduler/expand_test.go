@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func taskNames(tasks []internal.Task) []string {
+	var names []string
+	for _, t := range tasks {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestExpandTasks(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     []internal.Task
+		wantNames []string
+		wantDeps  map[string][]string
+		wantErr   string
+	}{
+		{
+			name: "foreachの要素ごとに展開し、依存先は展開したすべてのタスクになる",
+			tasks: []internal.Task{
+				{Name: "test", Foreach: internal.StringList{"api", "web"}},
+				{Name: "report", DependsOn: []string{"test"}},
+			},
+			wantNames: []string{"test-api", "test-web", "report"},
+			wantDeps:  map[string][]string{"report": {"test-api", "test-web"}},
+		},
+		{
+			name: "matrixはキーの名前順の組み合わせで展開する",
+			tasks: []internal.Task{
+				{Name: "build", Matrix: map[string][]string{"os": {"linux", "darwin"}, "arch": {"amd64", "arm64"}}},
+			},
+			wantNames: []string{"build-amd64-linux", "build-amd64-darwin", "build-arm64-linux", "build-arm64-darwin"},
+		},
+		{
+			name: "要素から作った名前が重複したら番号で区別する",
+			tasks: []internal.Task{
+				{Name: "lint", Foreach: internal.StringList{"a/x.go", "b/x.go", "!!"}},
+			},
+			wantNames: []string{"lint-x", "lint-2", "lint-3"},
+		},
+		{
+			name: "展開しないタスクはそのまま",
+			tasks: []internal.Task{
+				{Name: "a"},
+				{Name: "b", DependsOn: []string{"a"}},
+			},
+			wantNames: []string{"a", "b"},
+			wantDeps:  map[string][]string{"b": {"a"}},
+		},
+		{
+			name: "展開した名前が他のタスクと重複したらエラー",
+			tasks: []internal.Task{
+				{Name: "test", Foreach: internal.StringList{"api"}},
+				{Name: "test-api"},
+			},
+			wantErr: "重複しています: test-api",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandTasks(tt.tasks)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, 期待は %q を含むエラー", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := taskNames(got); !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("名前 = %v, 期待は %v", names, tt.wantNames)
+			}
+			for _, task := range got {
+				if want, ok := tt.wantDeps[task.Name]; ok && !reflect.DeepEqual(task.DependsOn, want) {
+					t.Errorf("%sの依存先 = %v, 期待は %v", task.Name, task.DependsOn, want)
+				}
+				if task.Group != "" && (task.Foreach != nil || task.Matrix != nil) {
+					t.Errorf("%s: 展開したタスクにforeach/matrixが残っています", task.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandTasksGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.md", "a.md", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ExpandTasks([]internal.Task{{Name: "doc", Foreach: internal.StringList{filepath.Join(dir, "*.md")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := taskNames(got); !reflect.DeepEqual(names, []string{"doc-a", "doc-b"}) {
+		t.Errorf("名前 = %v", names)
+	}
+	if got[0].Item != filepath.Join(dir, "a.md") || got[0].Group != "doc" {
+		t.Errorf("Item = %q, Group = %q", got[0].Item, got[0].Group)
+	}
+
+	_, err = ExpandTasks([]internal.Task{{Name: "doc", Foreach: internal.StringList{filepath.Join(dir, "*.none")}}})
+	if err == nil {
+		t.Error("一致するファイルがないglobはエラーになるはずです")
+	}
+}
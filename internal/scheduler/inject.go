@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InboxDir は実行中のrunに追加するタスクを置くディレクトリ(runディレクトリからの相対パス)。
+// 受け付けたファイルはaccepted/、受け付けなかったファイルはrejected/に移し、理由を<file>.errに書く
+const InboxDir = "inbox"
+
+// inboxPollInterval はinboxを確認する間隔
+const inboxPollInterval = 500 * time.Millisecond
+
+// errNotRunning はRunの実行中でないときにAddを呼んだ場合のエラー
+var errNotRunning = errors.New("実行中のrunがありません")
+
+// Add は実行中のDAGにタスクを追加する。Runの実行中だけ使える。
+// 依存先は実行済みのタスクでもよく、終わっていない依存先があればその完了を待って実行する
+func (s *Scheduler) Add(t internal.Task) error {
+	s.mu.Lock()
+	add := s.add
+	s.mu.Unlock()
+	if add == nil {
+		return errNotRunning
+	}
+	return add(t)
+}
+
+// checkAddedTask は追加するタスクを検査する
+func checkAddedTask(t internal.Task, taskMap map[string]*internal.Task, roleTypes map[string]internal.RoleType, execMap map[string]internal.Executor) error {
+	if t.Name == "" {
+		return errors.New("nameがありません")
+	}
+	if _, ok := taskMap[t.Name]; ok {
+		return fmt.Errorf("タスク名が重複しています: %s", t.Name)
+	}
+	if len(t.Foreach) > 0 || len(t.Matrix) > 0 {
+		return errors.New("追加するタスクにはforeach/matrixを指定できません")
+	}
+	typ, ok := roleTypes[t.Role]
+	if !ok {
+		return fmt.Errorf("不明なロールです: %q", t.Role)
+	}
+	if _, ok := execMap[t.Role]; !ok {
+		return fmt.Errorf("ロール %s の実行器がありません (AIロールはrunの開始時に使われていたものだけ指定できます)", t.Role)
+	}
+	switch {
+	case typ == internal.RoleShell && strings.TrimSpace(t.Command) == "":
+		return errors.New("shellロールのタスクにcommandがありません")
+	case typ == internal.RoleAI && strings.TrimSpace(t.Prompt) == "":
+		return errors.New("AIロールのタスクにpromptがありません")
+	}
+	switch t.OnFailure {
+	case "", internal.OnFailureStop, internal.OnFailureContinue, internal.OnFailureSkipDependents:
+	default:
+		return fmt.Errorf("不明なon_failureです: %q (stop|continue|skip_dependents)", t.OnFailure)
+	}
+	if t.Retries < 0 || t.Backoff < 0 || t.Timeout < 0 {
+		return errors.New("retries/backoff/timeoutに負の値は指定できません")
+	}
+	for _, dep := range t.DependsOn {
+		if _, ok := taskMap[dep]; !ok {
+			return fmt.Errorf("不明な依存先です: %q", dep)
+		}
+	}
+	return nil
+}
+
+// watchInbox はdoneが閉じられるまでinboxのタスクを追加する
+func (s *Scheduler) watchInbox(dir string, done <-chan struct{}) {
+	ticker := time.NewTicker(inboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		sort.Strings(files)
+		for _, path := range files {
+			var t internal.Task
+			b, err := os.ReadFile(path)
+			if err == nil {
+				err = yaml.Unmarshal(b, &t)
+			}
+			if err == nil {
+				err = s.Add(t)
+			}
+			dest := filepath.Join(dir, "accepted")
+			if err != nil {
+				dest = filepath.Join(dir, "rejected")
+			}
+			os.MkdirAll(dest, 0755)
+			if err != nil {
+				os.WriteFile(filepath.Join(dest, filepath.Base(path)+".err"), []byte(err.Error()), 0644)
+			}
+			os.Rename(path, filepath.Join(dest, filepath.Base(path)))
+		}
+	}
+}
+
+// SubmitTask は実行中のrun(runDir)のinboxにタスクを置き、受け付けられるまで待つ
+func SubmitTask(runDir string, t internal.Task, wait time.Duration) error {
+	dir := filepath.Join(runDir, InboxDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(t)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.yaml", time.Now().UnixNano(), instanceSuffix(t.Name))
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(dir, "accepted", name)); err == nil {
+			return nil
+		}
+		if reason, err := os.ReadFile(filepath.Join(dir, "rejected", name+".err")); err == nil {
+			return errors.New(string(reason))
+		}
+		time.Sleep(inboxPollInterval / 2)
+	}
+	// 受け付けられなかったタスクが後で実行されないよう取り下げる
+	if os.Remove(path) == nil {
+		return errNotRunning
+	}
+	return fmt.Errorf("タスクの受け付けを確認できません (%s)", dir)
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Levels はタスクを依存関係の段に分ける。同じ段のタスクは同時に実行できる
+func Levels(tasks []internal.Task) [][]string {
+	level := map[string]int{}
+	byName := map[string]internal.Task{}
+	for _, t := range tasks {
+		byName[t.Name] = t
+	}
+	var depth func(name string, seen map[string]bool) int
+	depth = func(name string, seen map[string]bool) int {
+		if l, ok := level[name]; ok {
+			return l
+		}
+		if seen[name] {
+			return 0
+		}
+		seen[name] = true
+		l := 0
+		for _, dep := range byName[name].DependsOn {
+			if _, ok := byName[dep]; ok {
+				if d := depth(dep, seen) + 1; d > l {
+					l = d
+				}
+			}
+		}
+		level[name] = l
+		return l
+	}
+	var levels [][]string
+	for _, t := range tasks {
+		l := depth(t.Name, map[string]bool{})
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], t.Name)
+	}
+	for _, names := range levels {
+		sort.Strings(names)
+	}
+	return levels
+}
+
+// PreviewTask は実行前の計画表示のためにタスクを展開する。
+// 依存タスクの出力はまだないため、成功したものとして仮の値を使う
+func PreviewTask(t internal.Task, tasks []internal.Task, runDir string) (internal.Task, error) {
+	byName := map[string]internal.Task{}
+	for _, other := range tasks {
+		byName[other.Name] = other
+	}
+	deps := map[string]DepResult{}
+	results := map[string]string{}
+	for _, dep := range t.DependsOn {
+		d := byName[dep]
+		deps[dep] = DepResult{Output: fmt.Sprintf("<%sの出力>", dep), Status: internal.TaskSucceeded, Group: d.Group, Item: d.Item}
+		results[dep] = deps[dep].Output
+	}
+	run := RunInfo{ID: "<run-id>", Dir: runDir, StartedAt: time.Now()}
+	return renderTask(&t, run, deps, dependencyInput(&t, results))
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"reflect"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []internal.Task
+		want  [][]string
+	}{
+		{
+			name: "依存のないタスクは同じ段",
+			tasks: []internal.Task{
+				{Name: "b"},
+				{Name: "a"},
+			},
+			want: [][]string{{"a", "b"}},
+		},
+		{
+			name: "最も深い依存先の次の段",
+			tasks: []internal.Task{
+				{Name: "deploy", DependsOn: []string{"build", "test"}},
+				{Name: "test", DependsOn: []string{"build"}},
+				{Name: "build"},
+				{Name: "docs"},
+			},
+			want: [][]string{{"build", "docs"}, {"test"}, {"deploy"}},
+		},
+		{
+			name: "不明な依存先は無視する",
+			tasks: []internal.Task{
+				{Name: "a", DependsOn: []string{"missing"}},
+			},
+			want: [][]string{{"a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Levels(tt.tasks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Levels = %v, 期待は %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"clampany/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errTimeout はタスクの試行がTimeoutを超えたことを表す
+var errTimeout = errors.New("タイムアウトしました")
+
+// Attempt はタスクの1回の試行の記録
+type Attempt struct {
+	Attempt   int       `yaml:"attempt"`
+	StartedAt time.Time `yaml:"started_at"`
+	EndedAt   time.Time `yaml:"ended_at"`
+	Duration  float64   `yaml:"duration_seconds"`
+	ExitCode  *int      `yaml:"exit_code,omitempty"`
+	Error     string    `yaml:"error,omitempty"`
+}
+
+// executeOnce はタスクを1回実行する。Timeoutを超えたら実行を中断してerrTimeoutを返す。
+// lockがあれば取得してから実行し、タイムアウトはlockを取得してから数える
+func executeOnce(ctx context.Context, ex internal.Executor, lock *sync.Mutex, req internal.ExecRequest) (internal.ExecResult, error) {
+	if lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	t := req.Task
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	res, err := ex.Execute(ctx, req)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w (%s)", errTimeout, t.Timeout)
+	}
+	return res, err
+}
+
+// shouldRetry は失敗がRetryOnの条件に当てはまるかを返す
+func shouldRetry(t internal.Task, res internal.ExecResult, err error) bool {
+	if len(t.RetryOn) == 0 {
+		return true
+	}
+	for _, cond := range t.RetryOn {
+		if cond == "timeout" {
+			if errors.Is(err, errTimeout) {
+				return true
+			}
+			continue
+		}
+		if n, convErr := strconv.Atoi(cond); convErr == nil {
+			if res.ExitCode != nil && *res.ExitCode == n {
+				return true
+			}
+			continue
+		}
+		re, reErr := regexp.Compile(cond)
+		if reErr != nil {
+			continue
+		}
+		if re.MatchString(res.Output) || re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// executeWithRetry はタスクを実行し、失敗したらRetries回までBackoffを空けて再実行する。
+// ctxがキャンセルされたら再実行しない
+func executeWithRetry(ctx context.Context, ex internal.Executor, lock *sync.Mutex, req internal.ExecRequest) (internal.ExecResult, []Attempt, error) {
+	t := req.Task
+	var attempts []Attempt
+	for i := 0; ; i++ {
+		start := time.Now()
+		res, err := executeOnce(ctx, ex, lock, req)
+		end := time.Now()
+		a := Attempt{Attempt: i + 1, StartedAt: start, EndedAt: end, Duration: end.Sub(start).Seconds(), ExitCode: res.ExitCode}
+		if res.Duration > 0 {
+			a.Duration = res.Duration.Seconds()
+		}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		attempts = append(attempts, a)
+		if err == nil || i >= t.Retries || ctx.Err() != nil || !shouldRetry(t, res, err) {
+			return res, attempts, err
+		}
+		wait := t.Backoff << i
+		util.Info("[RETRY] %s: %v (%d/%d回目の再実行を%s後に行います)", t.Name, err, i+1, t.Retries, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return res, attempts, ctx.Err()
+		}
+	}
+}
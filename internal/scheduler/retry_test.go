@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestShouldRetry(t *testing.T) {
+	code := func(n int) *int { return &n }
+	exitErr := errors.New("exit status 75")
+	timeoutErr := fmt.Errorf("%w (1m0s)", errTimeout)
+	tests := []struct {
+		name    string
+		retryOn []string
+		res     internal.ExecResult
+		err     error
+		want    bool
+	}{
+		{name: "retry_onがなければすべて再実行", err: exitErr, want: true},
+		{name: "終了コードが一致", retryOn: []string{"75"}, res: internal.ExecResult{ExitCode: code(75)}, err: exitErr, want: true},
+		{name: "終了コードが不一致", retryOn: []string{"75"}, res: internal.ExecResult{ExitCode: code(1)}, err: exitErr, want: false},
+		{name: "終了コードを持たない失敗", retryOn: []string{"75"}, err: exitErr, want: false},
+		{name: "タイムアウト", retryOn: []string{"timeout"}, err: timeoutErr, want: true},
+		{name: "タイムアウト以外", retryOn: []string{"timeout"}, res: internal.ExecResult{ExitCode: code(1)}, err: exitErr, want: false},
+		{name: "出力が正規表現に一致", retryOn: []string{"rate limit"}, res: internal.ExecResult{Output: "error: rate limit exceeded"}, err: exitErr, want: true},
+		{name: "エラーが正規表現に一致", retryOn: []string{`status \d+`}, err: exitErr, want: true},
+		{name: "不正な正規表現は無視", retryOn: []string{"("}, err: exitErr, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := internal.Task{Name: "t", RetryOn: tt.retryOn}
+			if got := shouldRetry(task, tt.res, tt.err); got != tt.want {
+				t.Errorf("shouldRetry = %v, 期待は %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,32 +4,51 @@ import (
 	"clampany/internal"
 	"clampany/internal/executor"
 	"clampany/internal/util"
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Scheduler struct {
-	ReadyCh     chan *internal.Task
-	Wg          sync.WaitGroup
 	MaxParallel int
+
+	// Cache があれば指紋が同じタスクは実行せずに保存済みの出力を使う
+	Cache *Cache
+	// Force のタスクはキャッシュがあっても実行する
+	Force map[string]bool
+	// CacheOnly のタスクは実行せず、キャッシュがなければ失敗とする
+	CacheOnly map[string]bool
+	// Clarification はAIタスクが確認を求めたときの設定
+	Clarification internal.ClarificationConfig
+
+	mu  sync.Mutex
+	add func(t internal.Task) error // Runの実行中だけ設定される
 }
 
-func New(maxParallel int, numTasks int) *Scheduler {
+func New(maxParallel int) *Scheduler {
 	return &Scheduler{
-		ReadyCh:     make(chan *internal.Task, numTasks),
 		MaxParallel: maxParallel,
 	}
 }
 
-func (s *Scheduler) Run(tasks []*internal.Task, execMap map[string]internal.Executor, runDir string, dEdges map[string][]string, roles []internal.Role) {
+// Run は依存関係に従ってタスクを実行し、結果をrunDirに保存する。失敗したタスクがあればエラーを返す。
+// AIロールの実行器は呼び出し側がペインを用意してexecMapに渡すこと。
+// 実行中はAddまたはrunDir/inboxでタスクを追加でき、追加したタスクもすべて終わるまで待つ
+func (s *Scheduler) Run(tasks []*internal.Task, execMap map[string]internal.Executor, runDir string, dEdges map[string][]string, roles []internal.Role) error {
+	if err := os.MkdirAll(filepath.Join(runDir, "outputs"), 0755); err != nil {
+		return err
+	}
+	clar, err := newClarifier(s.Clarification)
+	if err != nil {
+		return err
+	}
 	taskMap := map[string]*internal.Task{}
 	for _, t := range tasks {
 		taskMap[t.Name] = t
@@ -46,141 +65,381 @@ func (s *Scheduler) Run(tasks []*internal.Task, execMap map[string]internal.Exec
 			children[dep] = append(children[dep], t.Name)
 		}
 	}
+	// 実行中のタスクはon_failure: stopで中断する
+	ctx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
 	var mu sync.Mutex
+	run := RunInfo{ID: filepath.Base(runDir), Dir: runDir, StartedAt: time.Now()}
 	results := map[string]string{}
-	failures := map[string]error{}
-	numTasks := len(tasks)
-	var doneCount int32
-	// AIロールごとにペインを作成し、ロール名→ペインIDのマップを作る
-	paneMap := map[string]string{}
-	for _, r := range roles {
-		if r.Type == internal.RoleAI {
-			cmd := exec.Command("tmux", "split-window", "-v", "-P", "-F", "#{pane_id}", "bash")
-			out, err := cmd.Output()
-			if err == nil {
-				paneID := strings.TrimSpace(string(out))
-				paneMap[r.Name] = paneID
-				exec.Command("tmux", "select-pane", "-t", paneID, "-T", r.Name).Run()
-				// claudeを永続起動
-				exec.Command("tmux", "send-keys", "-t", paneID, "claude", "Enter").Run()
+	deps := map[string]DepResult{}
+	records := map[string]*TaskRecord{}
+	for _, t := range tasks {
+		records[t.Name] = &TaskRecord{Role: t.Role, Group: t.Group, Item: t.Item, Matrix: t.MatrixValues, State: internal.TaskPending}
+	}
+	// 実行できるタスクの待ち行列。タスクは実行中にも追加されるため、件数を固定したチャネルは使わない
+	var ready []*internal.Task
+	readyCond := sync.NewCond(&mu)
+	doneCount := 0
+	closed := len(tasks) == 0
+	// propagate は終了したタスクが依存するタスクに与える状態とその理由。空なら依存するタスクを進める
+	type propagation struct{ state, reason string }
+	propagate := map[string]propagation{}
+	stopped := ""
+
+	// 以下の関数はmuを保持して呼ぶ
+	enqueue := func(t *internal.Task) {
+		ready = append(ready, t)
+		readyCond.Signal()
+	}
+	// finish はタスクを終了状態にし、追加されたものも含めてすべて終わったら待ち行列を閉じる
+	finish := func(name, state string) {
+		records[name].State = state
+		doneCount++
+		if doneCount == len(records) {
+			closed = true
+			readyCond.Broadcast()
+		}
+	}
+	// skip は未実行のタスクとそれに依存するタスクをskipped/cancelledにする
+	var skip func(name, state, reason string)
+	skip = func(name, state, reason string) {
+		rec := records[name]
+		if rec.State != internal.TaskPending {
+			return
+		}
+		rec.Error = reason
+		util.Info("[%s] %s: %s", strings.ToUpper(state), name, reason)
+		finish(name, state)
+		why := name + "がスキップされたため"
+		if state == internal.TaskCancelled {
+			why = name + "が中止されたため"
+		}
+		propagate[name] = propagation{state, why}
+		for _, child := range children[name] {
+			skip(child, state, why)
+		}
+	}
+	// complete は実行を終えたタスクの結果をon_failureに従って依存するタスクに反映する
+	complete := func(t *internal.Task, state string) {
+		finish(t.Name, state)
+		policy := t.OnFailure
+		if policy == "" {
+			policy = internal.OnFailureSkipDependents
+		}
+		if state == internal.TaskFailed && policy == internal.OnFailureStop {
+			stopped = t.Name + "が失敗したため中止"
+			cancelRun()
+			for _, other := range tasks {
+				skip(other.Name, internal.TaskCancelled, t.Name+"が失敗したため中止")
+			}
+			return
+		}
+		if state == internal.TaskFailed && policy == internal.OnFailureSkipDependents {
+			propagate[t.Name] = propagation{internal.TaskSkipped, t.Name + "が失敗したため"}
+		}
+		for _, child := range children[t.Name] {
+			if p, ok := propagate[t.Name]; ok {
+				skip(child, p.state, p.reason)
+				continue
+			}
+			depCount[child]--
+			if depCount[child] == 0 && records[child].State == internal.TaskPending {
+				enqueue(taskMap[child])
 			}
 		}
 	}
-	exec.Command("tmux", "select-layout", "tiled").Run()
 
-	// ロール名→RoleTypeのマップを作成
-	roleTypeMap := map[string]internal.RoleType{}
+	// AIロールはペインを1つしか持たないため、同時に2つのタスクを送らない
+	roleLocks := map[string]*sync.Mutex{}
 	for _, r := range roles {
-		roleTypeMap[r.Name] = r.Type
+		if r.Type == internal.RoleAI {
+			roleLocks[r.Name] = &sync.Mutex{}
+		}
+	}
+
+	// execute はタスクを実行器で実行する。実行中の出力はoutputs/<task>.logに書き、
+	// 成果物はartifacts/<task>/に置かせる
+	execute := func(t internal.Task, in string) (internal.ExecResult, []Attempt, error) {
+		ex, ok := execMap[t.Role]
+		if !ok {
+			return internal.ExecResult{}, nil, fmt.Errorf("ロール %s の実行器がありません", t.Role)
+		}
+		req := internal.ExecRequest{Task: t, Input: in, ArtifactDir: filepath.Join(runDir, "artifacts", t.Name)}
+		if f, err := os.OpenFile(filepath.Join(runDir, "outputs", t.Name+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+			defer f.Close()
+			req.Stream = f
+		}
+		res, attempts, err := executeWithRetry(ctx, ex, roleLocks[t.Role], req)
+		// 成果物がなければ空のディレクトリを残さない
+		os.Remove(req.ArtifactDir)
+		return res, attempts, err
 	}
 
-	// AIExecutorはexecMapに格納しない
+	roleTypes := map[string]internal.RoleType{}
 	for _, r := range roles {
-		if r.Type != internal.RoleAI {
+		roleTypes[r.Name] = r.Type
+		if _, ok := execMap[r.Name]; ok {
+			continue
+		}
+		switch r.Type {
+		case internal.RoleShell:
+			execMap[r.Name] = &executor.ShellExecutor{}
+		case internal.RoleHuman:
 			execMap[r.Name] = &executor.HumanExecutor{}
 		}
 	}
 
+	// add は実行中のDAGにタスクを追加する。終わった依存先は結果に応じて扱う
+	add := func(t internal.Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return errNotRunning
+		}
+		if stopped != "" {
+			return fmt.Errorf("実行は中止されています: %s", stopped)
+		}
+		if err := checkAddedTask(t, taskMap, roleTypes, execMap); err != nil {
+			return err
+		}
+		nt := &t
+		tasks = append(tasks, nt)
+		taskMap[t.Name] = nt
+		records[t.Name] = &TaskRecord{Role: t.Role, State: internal.TaskPending, Added: true}
+		util.Info("[ADDED] %s (%s)", t.Name, t.Role)
+		waiting := 0
+		var skipped *propagation
+		for _, dep := range t.DependsOn {
+			switch records[dep].State {
+			case internal.TaskPending, internal.TaskRunning:
+				waiting++
+				children[dep] = append(children[dep], t.Name)
+			default:
+				if p, ok := propagate[dep]; ok && skipped == nil {
+					skipped = &p
+				}
+			}
+		}
+		depCount[t.Name] = waiting
+		switch {
+		case skipped != nil:
+			skip(t.Name, skipped.state, skipped.reason)
+		case waiting == 0:
+			enqueue(nt)
+		}
+		return nil
+	}
+	s.mu.Lock()
+	s.add = add
+	s.mu.Unlock()
+	inboxDone := make(chan struct{})
+	go s.watchInbox(filepath.Join(runDir, InboxDir), inboxDone)
+
 	// ワーカープール起動
+	var wg sync.WaitGroup
 	for i := 0; i < s.MaxParallel; i++ {
-		s.Wg.Add(1)
+		wg.Add(1)
 		go func(workerIdx int) {
-			defer s.Wg.Done()
-			for t := range s.ReadyCh {
-				util.Info("[RUNNING] %s", t.Name)
-				var out string
-				var err error
-				if roleTypeMap[t.Role] == internal.RoleAI {
-					atomic.AddInt32(&doneCount, 1)
-					if int(atomic.LoadInt32(&doneCount)) == numTasks {
-						close(s.ReadyCh)
-					}
-					s.Wg.Done()
-					continue // AIタスクは永続ワーカーで処理するためスキップ
-				}
-				// Human/Shellのみ従来通りexecMapを使う
-				exec := execMap[t.Role]
-				out, err = exec.Execute(*t, "")
+			defer wg.Done()
+			for {
 				mu.Lock()
-				if err != nil {
-					failures[t.Name] = err
-					util.Fail("%s: %v", t.Name, err)
-				} else {
-					results[t.Name] = out
-					util.Success("%s 完了", t.Name)
-					// 出力保存
-					fpath := filepath.Join(runDir, "outputs", fmt.Sprintf("%s.md", t.Name))
-					os.WriteFile(fpath, []byte(out), 0644)
-					// clarification flow: needs_clarification検出
-					if strings.Contains(out, "needs_clarification") {
-						util.Info("clarificationフロー発動: %s", t.Name)
-						// 簡易的にplanner1にclarificationタスクを追加
-						clarTask := &internal.Task{
-							Name:      t.Name + "_clarify",
-							Role:      "planner1",
-							Prompt:    "エンジニアからの質問: " + out,
-							DependsOn: []string{t.Name},
-						}
-						mu.Lock()
-						results[clarTask.Name] = ""
+				for len(ready) == 0 && !closed {
+					readyCond.Wait()
+				}
+				if len(ready) == 0 {
+					mu.Unlock()
+					return
+				}
+				t := ready[0]
+				ready = ready[1:]
+				rec := records[t.Name]
+				// キューに入った後でキャンセルされたタスクは実行しない
+				if rec.State != internal.TaskPending {
+					mu.Unlock()
+					continue
+				}
+				in := dependencyInput(t, results)
+				if t.When != "" {
+					ok, err := evalCondition(t, run, deps, in)
+					if err == nil && !ok {
+						// 条件を満たさないタスクはスキップし、依存するタスクはそのまま進める
+						rec.Error = "whenの条件を満たさないため"
+						util.Info("[SKIPPED] %s: %s", t.Name, rec.Error)
+						deps[t.Name] = DepResult{Status: internal.TaskSkipped, Group: t.Group, Item: t.Item}
+						complete(t, internal.TaskSkipped)
 						mu.Unlock()
-						s.ReadyCh <- clarTask
-						// 元タスクを再実行（clarificationタスク完了後に）
-						child := &internal.Task{
-							Name:      t.Name + "_retry",
-							Role:      t.Role,
-							Prompt:    t.Prompt + "\n(clarification反映済み)",
-							DependsOn: []string{clarTask.Name},
-						}
-						mu.Lock()
-						results[child.Name] = ""
+						continue
+					}
+					if err != nil {
+						rec.Error = err.Error()
+						util.Fail("%s: %v", t.Name, err)
+						deps[t.Name] = DepResult{Status: internal.TaskFailed, Group: t.Group, Item: t.Item}
+						complete(t, internal.TaskFailed)
 						mu.Unlock()
-						s.ReadyCh <- child
+						continue
+					}
+				}
+				rec.State = internal.TaskRunning
+				rec.StartedAt = time.Now()
+				rendered, err := renderTask(t, run, deps, in)
+				// テンプレートで依存タスクの出力を参照するタスクには自動で付けない
+				if isTemplate(t.Prompt) || isTemplate(t.Command) {
+					in = ""
+				}
+				var out, fp string
+				hit := false
+				if err == nil && !t.NoCache {
+					fp = Fingerprint(rendered, in, deps)
+					rec.Fingerprint = fp
+					if !s.Force[t.Name] {
+						out, hit = s.Cache.Load(fp)
 					}
 				}
+				if err == nil && !hit && s.CacheOnly[t.Name] {
+					err = fmt.Errorf("キャッシュがありません (--onlyで指定していないタスクは実行しません)")
+				}
+				rec.Cached = hit
 				mu.Unlock()
-				// 子タスクの依存カウントを減らし、0になればReadyChへ
-				for _, child := range children[t.Name] {
-					mu.Lock()
-					depCount[child]--
-					if depCount[child] == 0 {
-						s.ReadyCh <- taskMap[child]
+				if hit {
+					util.Info("[CACHED] %s", t.Name)
+				} else if err == nil {
+					util.Info("[RUNNING] %s", t.Name)
+				}
+				// 展開に失敗したタスクは実行しない
+				var attempts []Attempt
+				var rounds []ClarificationRound
+				var res internal.ExecResult
+				if err == nil && !hit {
+					res, attempts, err = execute(rendered, in)
+					// AIタスクは確認を求めることがある。回答を得て再実行した最後の出力を結果とする
+					if err == nil && roleLocks[t.Role] != nil {
+						var more []Attempt
+						res, rounds, more, err = clar.clarify(rendered, in, res, execute)
+						for _, a := range more {
+							a.Attempt = len(attempts) + 1
+							attempts = append(attempts, a)
+						}
 					}
-					mu.Unlock()
+					out = res.Output
 				}
-				atomic.AddInt32(&doneCount, 1)
-				if int(atomic.LoadInt32(&doneCount)) == numTasks {
-					close(s.ReadyCh)
+				mu.Lock()
+				progress := fmt.Sprintf("[%d/%d]", doneCount+1, len(records))
+				rec.EndedAt = time.Now()
+				rec.Attempts = attempts
+				rec.Clarifications = rounds
+				for _, path := range res.Artifacts {
+					if rel, err := filepath.Rel(runDir, path); err == nil {
+						path = rel
+					}
+					rec.Artifacts = append(rec.Artifacts, path)
+				}
+				if err != nil && stopped != "" && errors.Is(err, context.Canceled) {
+					// 他のタスクの失敗で中断したタスクは失敗ではなく中止とする
+					rec.Error = stopped
+					deps[t.Name] = DepResult{Status: internal.TaskCancelled, Group: t.Group, Item: t.Item}
+					util.Info("[CANCELLED] %s: %s", t.Name, stopped)
+					complete(t, internal.TaskCancelled)
+				} else if err != nil {
+					rec.Error = err.Error()
+					deps[t.Name] = DepResult{Output: out, Status: internal.TaskFailed, Group: t.Group, Item: t.Item}
+					util.Fail("%s %s: %v", progress, t.Name, err)
+					complete(t, internal.TaskFailed)
+				} else {
+					results[t.Name] = out
+					if !hit && fp != "" {
+						if err := s.Cache.Store(fp, out); err != nil {
+							util.Info("%s: キャッシュの保存に失敗: %v", t.Name, err)
+						}
+					}
+					deps[t.Name] = DepResult{Output: out, Status: internal.TaskSucceeded, Group: t.Group, Item: t.Item}
+					util.Success("%s %s 完了", progress, t.Name)
+					// 出力保存
+					rec.Output = filepath.Join("outputs", fmt.Sprintf("%s.md", t.Name))
+					os.WriteFile(filepath.Join(runDir, rec.Output), []byte(out), 0644)
+					complete(t, internal.TaskSucceeded)
 				}
+				mu.Unlock()
 			}
 		}(i)
 	}
-	// ワーカー起動後にReadyなタスクをチャネルに入れる
-	for name, cnt := range depCount {
-		if cnt == 0 {
-			s.ReadyCh <- taskMap[name]
+	// ワーカー起動後にReadyなタスクを待ち行列に入れる
+	mu.Lock()
+	for _, t := range tasks {
+		if depCount[t.Name] == 0 {
+			enqueue(t)
 		}
 	}
-	s.Wg.Wait()
+	mu.Unlock()
+	wg.Wait()
+	s.mu.Lock()
+	s.add = nil
+	s.mu.Unlock()
+	close(inboxDone)
+
 	// run.yaml保存
-	summary := map[string]interface{}{
-		"status":    "success",
-		"timestamp": time.Now().Format(time.RFC3339),
+	summary := RunRecord{
+		Status:    "success",
+		StartedAt: run.StartedAt,
+		EndedAt:   time.Now(),
+		Tasks:     records,
+	}
+	failed := 0
+	for _, rec := range records {
+		switch rec.State {
+		case internal.TaskFailed:
+			failed++
+			summary.Status = "fail"
+		case internal.TaskCancelled:
+			summary.Status = "fail"
+		}
 	}
-	if len(failures) > 0 {
-		summary["status"] = "fail"
-		summary["failures"] = failures
+	f, err := os.Create(filepath.Join(runDir, "run.yaml"))
+	if err != nil {
+		return err
 	}
-	f, _ := os.Create(filepath.Join(runDir, "run.yaml"))
 	yaml.NewEncoder(f).Encode(summary)
 	f.Close()
+	if summary.Status != "success" {
+		return fmt.Errorf("%d件のタスクが失敗しました", failed)
+	}
+	return nil
 }
 
-func replaceInput(prompt, input string) string {
-	return stringReplace(prompt, "{{input}}", input)
+// RunRecord はrun.yamlに保存する実行結果
+type RunRecord struct {
+	Status    string                 `yaml:"status"`
+	StartedAt time.Time              `yaml:"started_at"`
+	EndedAt   time.Time              `yaml:"ended_at"`
+	Tasks     map[string]*TaskRecord `yaml:"tasks"`
 }
 
-func stringReplace(s, old, new string) string {
-	return fmt.Sprintf("%s", s)
-	// TODO: strings.ReplaceAll(s, old, new) に置き換え
+// TaskRecord はタスクごとの状態と実行結果
+type TaskRecord struct {
+	Role        string            `yaml:"role"`
+	Group       string            `yaml:"group,omitempty"` // foreach/matrixの展開元
+	Item        string            `yaml:"item,omitempty"`
+	Matrix      map[string]string `yaml:"matrix,omitempty"`
+	State       string            `yaml:"state"`
+	StartedAt   time.Time         `yaml:"started_at,omitempty"`
+	EndedAt     time.Time         `yaml:"ended_at,omitempty"`
+	Attempts    []Attempt         `yaml:"attempts,omitempty"`
+	Output      string            `yaml:"output,omitempty"` // runディレクトリからの相対パス
+	Fingerprint string            `yaml:"fingerprint,omitempty"`
+	Cached      bool              `yaml:"cached,omitempty"` // キャッシュの出力を使った
+	Error       string            `yaml:"error,omitempty"`
+	Added       bool              `yaml:"added,omitempty"`     // 実行中に追加されたタスク
+	Artifacts   []string          `yaml:"artifacts,omitempty"` // runディレクトリからの相対パス
+
+	Clarifications []ClarificationRound `yaml:"clarifications,omitempty"`
+}
+
+// dependencyInput は依存タスクの出力をまとめてタスクへの入力にする
+func dependencyInput(t *internal.Task, results map[string]string) string {
+	var parts []string
+	for _, dep := range t.DependsOn {
+		if out := strings.TrimSpace(results[dep]); out != "" {
+			parts = append(parts, fmt.Sprintf("## %s\n\n%s", dep, out))
+		}
+	}
+	return strings.Join(parts, "\n\n")
 }
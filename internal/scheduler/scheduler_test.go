@@ -0,0 +1,268 @@
+package scheduler
+
+import (
+	"clampany/internal"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fakeExecutor はタスクごとにfnの結果を返す実行器。呼ばれたタスク名を記録する
+type fakeExecutor struct {
+	mu    sync.Mutex
+	calls []string
+	fn    func(ctx context.Context, t internal.Task, in string) (string, error)
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, req internal.ExecRequest) (internal.ExecResult, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, req.Task.Name)
+	f.mu.Unlock()
+	out, err := f.fn(ctx, req.Task, req.Input)
+	return internal.ExecResult{Output: out}, err
+}
+
+func (f *fakeExecutor) called(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == name {
+			n++
+		}
+	}
+	return n
+}
+
+var shellRoles = []internal.Role{{Name: "build", Type: internal.RoleShell}}
+
+// runTasks はtasksを実行し、Runのエラーとrun.yamlの内容を返す
+func runTasks(t *testing.T, s *Scheduler, tasks []internal.Task, execMap map[string]internal.Executor, roles []internal.Role) (RunRecord, error) {
+	t.Helper()
+	dir := t.TempDir()
+	ptrs := make([]*internal.Task, len(tasks))
+	for i := range tasks {
+		ptrs[i] = &tasks[i]
+	}
+	runErr := s.Run(ptrs, execMap, dir, nil, roles)
+	var rec RunRecord
+	b, err := os.ReadFile(filepath.Join(dir, "run.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec, runErr
+}
+
+func checkStates(t *testing.T, rec RunRecord, want map[string]string) {
+	t.Helper()
+	for name, state := range want {
+		got, ok := rec.Tasks[name]
+		if !ok {
+			t.Errorf("%s: run.yamlにありません", name)
+			continue
+		}
+		if got.State != state {
+			t.Errorf("%s: 状態 = %s, 期待は %s (%s)", name, got.State, state, got.Error)
+		}
+	}
+}
+
+func TestRunOnFailure(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   map[string]string
+	}{
+		{"", map[string]string{"fail": internal.TaskFailed, "child": internal.TaskSkipped, "other": internal.TaskSucceeded}},
+		{internal.OnFailureSkipDependents, map[string]string{"fail": internal.TaskFailed, "child": internal.TaskSkipped, "other": internal.TaskSucceeded}},
+		{internal.OnFailureContinue, map[string]string{"fail": internal.TaskFailed, "child": internal.TaskSucceeded, "other": internal.TaskSucceeded}},
+	}
+	for _, tt := range tests {
+		t.Run("on_failure="+tt.policy, func(t *testing.T) {
+			ex := &fakeExecutor{fn: func(ctx context.Context, task internal.Task, in string) (string, error) {
+				if task.Name == "fail" {
+					return "", errors.New("exit status 1")
+				}
+				return "ok", nil
+			}}
+			tasks := []internal.Task{
+				{Name: "fail", Role: "build", Command: "false", OnFailure: tt.policy},
+				{Name: "child", Role: "build", Command: "true", DependsOn: []string{"fail"}},
+				{Name: "other", Role: "build", Command: "true"},
+			}
+			rec, err := runTasks(t, New(2), tasks, map[string]internal.Executor{"build": ex}, shellRoles)
+			if err == nil || rec.Status != "fail" {
+				t.Errorf("失敗したタスクがあるのにRunが成功しました: %v, status %s", err, rec.Status)
+			}
+			checkStates(t, rec, tt.want)
+			if tt.want["child"] == internal.TaskSkipped && ex.called("child") > 0 {
+				t.Error("スキップしたタスクを実行しました")
+			}
+		})
+	}
+
+	t.Run("on_failure=stop", func(t *testing.T) {
+		started := make(chan struct{})
+		ex := &fakeExecutor{fn: func(ctx context.Context, task internal.Task, in string) (string, error) {
+			switch task.Name {
+			case "fail":
+				// slowが実行中になってから失敗する
+				<-started
+				return "", errors.New("exit status 1")
+			case "slow":
+				close(started)
+				<-ctx.Done()
+				return "", ctx.Err()
+			}
+			return "ok", nil
+		}}
+		tasks := []internal.Task{
+			{Name: "fail", Role: "build", Command: "false", OnFailure: internal.OnFailureStop},
+			{Name: "slow", Role: "build", Command: "sleep 60"},
+			{Name: "child", Role: "build", Command: "true", DependsOn: []string{"fail"}},
+		}
+		rec, err := runTasks(t, New(2), tasks, map[string]internal.Executor{"build": ex}, shellRoles)
+		if err == nil {
+			t.Error("中止したのにRunが成功しました")
+		}
+		checkStates(t, rec, map[string]string{"fail": internal.TaskFailed, "slow": internal.TaskCancelled, "child": internal.TaskCancelled})
+		if ex.called("child") > 0 {
+			t.Error("中止後にタスクを実行しました")
+		}
+	})
+}
+
+func TestRunWhen(t *testing.T) {
+	ex := &fakeExecutor{fn: func(ctx context.Context, task internal.Task, in string) (string, error) {
+		if task.Name == "test" {
+			return "FAIL", nil
+		}
+		return "ok", nil
+	}}
+	tasks := []internal.Task{
+		{Name: "test", Role: "build", Command: "go test"},
+		{Name: "release", Role: "build", Command: "./release.sh", DependsOn: []string{"test"}, When: `.deps.test.output | contains "PASS"`},
+		{Name: "report", Role: "build", Command: "./report.sh", DependsOn: []string{"test"}, When: `{{ eq .deps.test.status "succeeded" }}`},
+		// 条件でスキップしたタスクに依存するタスクはそのまま実行する
+		{Name: "notify", Role: "build", Command: "./notify.sh", DependsOn: []string{"release"}},
+		{Name: "broken", Role: "build", Command: "true", When: `eq .deps.nothing.status "failed"`},
+	}
+	rec, err := runTasks(t, New(2), tasks, map[string]internal.Executor{"build": ex}, shellRoles)
+	if err == nil {
+		t.Error("whenの評価に失敗したタスクがあるのにRunが成功しました")
+	}
+	checkStates(t, rec, map[string]string{
+		"test":    internal.TaskSucceeded,
+		"release": internal.TaskSkipped,
+		"report":  internal.TaskSucceeded,
+		"notify":  internal.TaskSucceeded,
+		"broken":  internal.TaskFailed,
+	})
+	if ex.called("release") > 0 || ex.called("broken") > 0 {
+		t.Error("whenを満たさないタスクを実行しました")
+	}
+}
+
+func TestRunClarification(t *testing.T) {
+	roles := []internal.Role{{Name: "dev", Type: internal.RoleAI}, {Name: "pm", Type: internal.RoleAI}}
+	tests := []struct {
+		name       string
+		asks       int // devが確認を求める回数
+		onLimit    string
+		wantState  string
+		wantRounds int
+	}{
+		{"回答を得たら回答を付けて再実行する", 1, internal.ClarifyLimitFail, internal.TaskSucceeded, 1},
+		{"上限に達したら失敗にする", 3, internal.ClarifyLimitFail, internal.TaskFailed, 2},
+		{"上限に達したら最後の出力を受け入れる", 3, internal.ClarifyLimitAccept, internal.TaskSucceeded, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var final string
+			dev := &fakeExecutor{fn: func(ctx context.Context, task internal.Task, in string) (string, error) {
+				answers := strings.Count(task.Prompt, "回答:\n")
+				if answers < tt.asks {
+					return fmt.Sprintf("%s APIのバージョンは? (%d)", internal.ClarifyMarker, answers+1), nil
+				}
+				final = task.Prompt
+				return "実装しました", nil
+			}}
+			pm := &fakeExecutor{fn: func(ctx context.Context, task internal.Task, in string) (string, error) {
+				return "v2です", nil
+			}}
+			s := New(1)
+			s.Clarification = internal.ClarificationConfig{Roles: map[string]string{"dev": "pm"}, MaxRounds: 2, OnLimit: tt.onLimit}
+			tasks := []internal.Task{{Name: "impl", Role: "dev", Prompt: "実装してください"}}
+			rec, _ := runTasks(t, s, tasks, map[string]internal.Executor{"dev": dev, "pm": pm}, roles)
+			checkStates(t, rec, map[string]string{"impl": tt.wantState})
+			got := rec.Tasks["impl"].Clarifications
+			if len(got) != tt.wantRounds {
+				t.Fatalf("確認が%d回 (期待は%d回): %+v", len(got), tt.wantRounds, got)
+			}
+			if got[0].Role != "pm" || got[0].Answer != "v2です" || !strings.Contains(got[0].Question, "APIのバージョンは?") {
+				t.Errorf("1回目の確認 = %+v", got[0])
+			}
+			if pm.called("impl_clarify1") != 1 {
+				t.Errorf("pmへの確認 = %v", pm.calls)
+			}
+			if tt.asks == 1 && !strings.Contains(final, "v2です") {
+				t.Errorf("再実行のpromptに回答がありません:\n%s", final)
+			}
+		})
+	}
+}
+
+func TestRunAdd(t *testing.T) {
+	// 並列数1ではタスクを定義順に実行するため、planの実行時にはbrokenが失敗している
+	s := New(1)
+	addErrs := map[string]error{}
+	ex := &fakeExecutor{}
+	ex.fn = func(ctx context.Context, task internal.Task, in string) (string, error) {
+		switch task.Name {
+		case "broken":
+			return "", errors.New("exit status 1")
+		case "plan":
+			// 実行中のタスクに依存するタスクは終わるまで待ち、失敗したタスクに依存するタスクはスキップする
+			for _, nt := range []internal.Task{
+				{Name: "impl", Role: "build", Command: "make", DependsOn: []string{"plan"}},
+				{Name: "fix", Role: "build", Command: "make fix", DependsOn: []string{"broken"}},
+				{Name: "plan", Role: "build", Command: "again"},
+				{Name: "ghost", Role: "nobody", Command: "true"},
+			} {
+				addErrs[nt.Name] = s.Add(nt)
+			}
+		}
+		return task.Name + "の出力", nil
+	}
+	tasks := []internal.Task{
+		{Name: "broken", Role: "build", Command: "false"},
+		{Name: "plan", Role: "build", Command: "plan"},
+	}
+	rec, _ := runTasks(t, s, tasks, map[string]internal.Executor{"build": ex}, shellRoles)
+
+	if addErrs["impl"] != nil || addErrs["fix"] != nil {
+		t.Fatalf("Add = %v", addErrs)
+	}
+	if addErrs["plan"] == nil || addErrs["ghost"] == nil {
+		t.Errorf("重複した名前・不明なロールのタスクを追加できました: %v", addErrs)
+	}
+	checkStates(t, rec, map[string]string{"impl": internal.TaskSucceeded, "fix": internal.TaskSkipped})
+	if !rec.Tasks["impl"].Added {
+		t.Error("追加したタスクにaddedが記録されていません")
+	}
+	if ex.called("fix") > 0 {
+		t.Error("失敗したタスクに依存する追加タスクを実行しました")
+	}
+	if err := s.Add(internal.Task{Name: "late", Role: "build", Command: "true"}); !errors.Is(err, errNotRunning) {
+		t.Errorf("Runの終了後のAdd = %v", err)
+	}
+}
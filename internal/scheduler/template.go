@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"bytes"
+	"clampany/internal"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// includeBase はincludeで読み込めるファイルの基準ディレクトリ
+const includeBase = "_clampany"
+
+// includeDirs はincludeで読み込めるディレクトリ(includeBaseからの相対パス)
+var includeDirs = []string{"specification", "context"}
+
+// RunInfo はテンプレートから参照できる実行の情報
+type RunInfo struct {
+	ID        string
+	Dir       string
+	StartedAt time.Time
+}
+
+// DepResult はテンプレートから参照できる依存タスクの結果
+type DepResult struct {
+	Output string
+	Status string
+	Group  string // foreach/matrixの展開元のタスク名
+	Item   string // foreachの要素
+}
+
+// groupResult はforeach/matrixで展開したタスクの結果をまとめ、展開元の名前で参照できるようにする
+func groupResult(members []DepResult) map[string]interface{} {
+	var items []interface{}
+	var outputs []string
+	succeeded, skipped := 0, 0
+	for _, d := range members {
+		items = append(items, map[string]interface{}{"item": d.Item, "output": d.Output, "status": d.Status})
+		if out := strings.TrimSpace(d.Output); out != "" {
+			outputs = append(outputs, out)
+		}
+		switch d.Status {
+		case internal.TaskSucceeded:
+			succeeded++
+		case internal.TaskSkipped:
+			skipped++
+		}
+	}
+	status := internal.TaskFailed
+	switch {
+	case skipped == len(members):
+		status = internal.TaskSkipped
+	case succeeded+skipped == len(members):
+		status = internal.TaskSucceeded
+	}
+	return map[string]interface{}{"output": strings.Join(outputs, "\n\n"), "status": status, "items": items}
+}
+
+// templateData はテンプレートに渡す値。キーは小文字で参照する
+// 例: {{ .deps.plan.output }} {{ .run.id }} {{ .env.HOME }} {{ .item }} {{ .matrix.os }}
+func templateData(t *internal.Task, run RunInfo, deps map[string]DepResult) map[string]interface{} {
+	depData := map[string]interface{}{}
+	groups := map[string][]DepResult{}
+	for _, name := range t.DependsOn {
+		if d, ok := deps[name]; ok {
+			depData[name] = map[string]interface{}{"output": d.Output, "status": d.Status}
+			if d.Group != "" {
+				groups[d.Group] = append(groups[d.Group], d)
+			}
+		}
+	}
+	for group, members := range groups {
+		depData[group] = groupResult(members)
+	}
+	env := map[string]interface{}{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	data := map[string]interface{}{
+		"deps": depData,
+		"run": map[string]interface{}{
+			"id":         run.ID,
+			"dir":        run.Dir,
+			"started_at": run.StartedAt.Format(time.RFC3339),
+		},
+		"task": map[string]interface{}{"name": t.Name, "role": t.Role},
+		"env":  env,
+	}
+	if t.Item != "" {
+		data["item"] = t.Item
+	}
+	if t.MatrixValues != nil {
+		matrix := map[string]interface{}{}
+		for k, v := range t.MatrixValues {
+			matrix[k] = v
+		}
+		data["matrix"] = matrix
+	}
+	return data
+}
+
+// include は_clampany/specificationまたは_clampany/context以下のファイルを読み込む
+func include(path string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	allowed := false
+	for _, dir := range includeDirs {
+		if strings.HasPrefix(clean, dir+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed || filepath.IsAbs(clean) {
+		return "", fmt.Errorf("includeできるのは%s/{%s}以下のファイルだけです: %s", includeBase, strings.Join(includeDirs, ","), path)
+	}
+	b, err := os.ReadFile(filepath.Join(includeBase, clean))
+	if err != nil {
+		return "", fmt.Errorf("includeするファイルが読み込めません: %w", err)
+	}
+	return string(b), nil
+}
+
+// quote はシェルのコマンドに埋め込めるよう値をシングルクォートで囲む
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// renderTemplate はtext/templateでtextを展開する。存在しない値を参照した場合はエラーになる
+func renderTemplate(name, text string, data map[string]interface{}, input string) (string, error) {
+	funcs := template.FuncMap{
+		"include":  include,
+		"quote":    quote,
+		"contains": func(substr, s string) bool { return strings.Contains(s, substr) },
+		"matches": func(pattern, s string) (bool, error) {
+			return regexp.MatchString(pattern, s)
+		},
+		// 従来の{{input}}は依存タスクの出力をまとめたもの
+		"input": func() string { return input },
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// isTemplate はtextがテンプレートの記法を含むかを返す
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// renderTask はタスクのpromptとcommandを展開したコピーを返す
+func renderTask(t *internal.Task, run RunInfo, deps map[string]DepResult, input string) (internal.Task, error) {
+	rendered := *t
+	data := templateData(t, run, deps)
+	var err error
+	if rendered.Prompt, err = renderTemplate(t.Name+".prompt", t.Prompt, data, input); err != nil {
+		return rendered, fmt.Errorf("promptの展開に失敗: %w", err)
+	}
+	if rendered.Command, err = renderTemplate(t.Name+".command", t.Command, data, input); err != nil {
+		return rendered, fmt.Errorf("commandの展開に失敗: %w", err)
+	}
+	return rendered, nil
+}
+
+// evalCondition はタスクのwhenを評価する。{{ }}を省略した式も書ける
+// 例: when: eq .deps.test.status "failed"
+func evalCondition(t *internal.Task, run RunInfo, deps map[string]DepResult, input string) (bool, error) {
+	expr := t.When
+	if !isTemplate(expr) {
+		expr = "{{ " + expr + " }}"
+	}
+	out, err := renderTemplate(t.Name+".when", expr, templateData(t, run, deps), input)
+	if err != nil {
+		return false, fmt.Errorf("whenの評価に失敗: %w", err)
+	}
+	switch strings.TrimSpace(out) {
+	case "true":
+		return true, nil
+	case "false", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("whenの結果がtrue/falseではありません: %q", strings.TrimSpace(out))
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event はevents.jsonlに1行ずつ追記するイベント
+type Event struct {
+	Time      time.Time              `json:"time"`
+	Type      string                 `json:"type"`
+	Role      string                 `json:"role,omitempty"`
+	MessageID string                 `json:"message_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+var (
+	eventMu   sync.Mutex
+	eventPath string
+)
+
+// SetEventLog はイベントの追記先を設定する。空ならイベントを記録しない
+func SetEventLog(path string) {
+	eventMu.Lock()
+	eventPath = path
+	eventMu.Unlock()
+}
+
+// Emit はイベントを追記する。複数プロセスから同じファイルに書くため、1行を1回のwriteで追記する
+func Emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if eventPath == "" {
+		return
+	}
+	f, err := os.OpenFile(eventPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	f.Write(append(b, '\n'))
+	f.Close()
+}